@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"github.com/cloudfoundry/sonde-go/events"
+	gogojsonpb "github.com/gogo/protobuf/jsonpb"
+	"github.com/golang/protobuf/jsonpb"
+)
+
+// capturedEnvelope is a decoded envelope as it is dumped and served. Only
+// one of V1 and V2 is set.
+type capturedEnvelope struct {
+	Time     time.Time
+	Type     string
+	SourceID string
+	V1       *events.Envelope
+	V2       *loggregator_v2.Envelope
+}
+
+// MarshalJSON encodes the envelope with jsonpb, the way rlpreader writes
+// envelopes, so that the output of the two tools can be compared.
+func (e capturedEnvelope) MarshalJSON() ([]byte, error) {
+	var env bytes.Buffer
+	var err error
+	switch {
+	case e.V1 != nil:
+		m := gogojsonpb.Marshaler{}
+		err = m.Marshal(&env, e.V1)
+	case e.V2 != nil:
+		m := jsonpb.Marshaler{}
+		err = m.Marshal(&env, e.V2)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := struct {
+		Time     time.Time       `json:"time"`
+		Type     string          `json:"type"`
+		SourceID string          `json:"source_id"`
+		V1       json.RawMessage `json:"v1,omitempty"`
+		V2       json.RawMessage `json:"v2,omitempty"`
+	}{
+		Time:     e.Time,
+		Type:     e.Type,
+		SourceID: e.SourceID,
+	}
+	if e.V1 != nil {
+		out.V1 = env.Bytes()
+	} else if e.V2 != nil {
+		out.V2 = env.Bytes()
+	}
+	return json.Marshal(out)
+}
+
+// recorder counts the decoded envelopes by type and source ID. It keeps the
+// most recent envelopes in memory and optionally dumps each as a JSON line.
+type recorder struct {
+	limit int
+
+	mu         sync.Mutex
+	total      uint64
+	byType     map[string]uint64
+	bySourceID map[string]uint64
+	envelopes  []capturedEnvelope
+	dump       *json.Encoder
+}
+
+// newRecorder returns a recorder that keeps up to limit envelopes in memory
+// and dumps them to dump if it is not nil.
+func newRecorder(limit int, dump io.Writer) *recorder {
+	r := &recorder{
+		limit:      limit,
+		byType:     make(map[string]uint64),
+		bySourceID: make(map[string]uint64),
+		envelopes:  []capturedEnvelope{},
+	}
+	if dump != nil {
+		r.dump = json.NewEncoder(dump)
+	}
+	return r
+}
+
+// RecordV1 records a v1 envelope.
+func (r *recorder) RecordV1(env *events.Envelope) {
+	r.record(capturedEnvelope{
+		Time:     time.Now(),
+		Type:     env.GetEventType().String(),
+		SourceID: v1SourceID(env),
+		V1:       env,
+	})
+}
+
+// RecordV2 records a v2 envelope.
+func (r *recorder) RecordV2(env *loggregator_v2.Envelope) {
+	r.record(capturedEnvelope{
+		Time:     time.Now(),
+		Type:     v2Type(env),
+		SourceID: env.GetSourceId(),
+		V2:       env,
+	})
+}
+
+func (r *recorder) record(e capturedEnvelope) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.total++
+	r.byType[e.Type]++
+	r.bySourceID[e.SourceID]++
+
+	if r.limit > 0 {
+		if len(r.envelopes) == r.limit {
+			copy(r.envelopes, r.envelopes[1:])
+			r.envelopes = r.envelopes[:r.limit-1]
+		}
+		r.envelopes = append(r.envelopes, e)
+	}
+
+	if r.dump != nil {
+		err := r.dump.Encode(e)
+		if err != nil {
+			log.Printf("failed to dump envelope: %s", err)
+		}
+	}
+}
+
+// v1SourceID returns the app ID of log messages and container metrics, and
+// the origin of other envelopes.
+func v1SourceID(env *events.Envelope) string {
+	switch env.GetEventType() {
+	case events.Envelope_LogMessage:
+		return env.GetLogMessage().GetAppId()
+	case events.Envelope_ContainerMetric:
+		return env.GetContainerMetric().GetApplicationId()
+	default:
+		return env.GetOrigin()
+	}
+}
+
+func v2Type(env *loggregator_v2.Envelope) string {
+	switch env.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		return "log"
+	case *loggregator_v2.Envelope_Counter:
+		return "counter"
+	case *loggregator_v2.Envelope_Gauge:
+		return "gauge"
+	case *loggregator_v2.Envelope_Timer:
+		return "timer"
+	case *loggregator_v2.Envelope_Event:
+		return "event"
+	default:
+		return "unknown"
+	}
+}
+
+// ServeHTTP serves the counts on /stats and the recent envelopes on
+// /envelopes as JSON.
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var body interface{}
+	switch req.URL.Path {
+	case "/stats":
+		body = struct {
+			Total      uint64            `json:"total"`
+			ByType     map[string]uint64 `json:"by_type"`
+			BySourceID map[string]uint64 `json:"by_source_id"`
+		}{
+			Total:      r.total,
+			ByType:     r.byType,
+			BySourceID: r.bySourceID,
+		}
+	case "/envelopes":
+		body = r.envelopes
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(body)
+	if err != nil {
+		log.Printf("failed to write response: %s", err)
+	}
+}
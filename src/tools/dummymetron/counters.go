@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+// listenerCounters count the envelopes of one listener. Errored counts
+// reads and decodes that failed. Truncated counts UDP datagrams that filled
+// the read buffer and so may have been cut short.
+type listenerCounters struct {
+	Received  uint64 `json:"received"`
+	Errored   uint64 `json:"errored"`
+	Truncated uint64 `json:"truncated"`
+}
+
+func (c *listenerCounters) received(n int) {
+	atomic.AddUint64(&c.Received, uint64(n))
+}
+
+func (c *listenerCounters) errored() {
+	atomic.AddUint64(&c.Errored, 1)
+}
+
+func (c *listenerCounters) truncated() {
+	atomic.AddUint64(&c.Truncated, 1)
+}
+
+func (c *listenerCounters) load() listenerCounters {
+	return listenerCounters{
+		Received:  atomic.LoadUint64(&c.Received),
+		Errored:   atomic.LoadUint64(&c.Errored),
+		Truncated: atomic.LoadUint64(&c.Truncated),
+	}
+}
+
+// counters are the counters of each listener. They are served as JSON on
+// /counters.
+type counters struct {
+	UDP  listenerCounters
+	GRPC listenerCounters
+}
+
+func (c *counters) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(map[string]listenerCounters{
+		"udp":  c.UDP.load(),
+		"grpc": c.GRPC.load(),
+	})
+	if err != nil {
+		log.Printf("failed to write response: %s", err)
+	}
+}
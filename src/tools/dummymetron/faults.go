@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// faults simulate a misbehaving agent. The zero value injects no faults.
+type faults struct {
+	// latency delays the handling of each Send request and the start of
+	// each stream.
+	latency time.Duration
+	// slowRead delays each read from a stream or the UDP listener, which
+	// applies backpressure to the sender.
+	slowRead time.Duration
+	// resetRate is the probability that a stream is reset with UNAVAILABLE
+	// after a read.
+	resetRate float64
+	// exhaustedRate is the probability that a read or a Send request fails
+	// with RESOURCE_EXHAUSTED.
+	exhaustedRate float64
+	// restartInterval is how often the listeners are closed and reopened
+	// after restartDowntime. Zero disables restarts.
+	restartInterval time.Duration
+	restartDowntime time.Duration
+}
+
+// respond waits for the configured latency.
+func (f faults) respond() {
+	if f.latency > 0 {
+		time.Sleep(f.latency)
+	}
+}
+
+// read waits before a read, to apply backpressure.
+func (f faults) read() {
+	if f.slowRead > 0 {
+		time.Sleep(f.slowRead)
+	}
+}
+
+// streamErr returns the error that resets a stream after a read, if any.
+func (f faults) streamErr() error {
+	if f.resetRate > 0 && rand.Float64() < f.resetRate {
+		return grpc.Errorf(codes.Unavailable, "injected stream reset")
+	}
+	return f.requestErr()
+}
+
+// requestErr returns the error that fails a request, if any.
+func (f faults) requestErr() error {
+	if f.exhaustedRate > 0 && rand.Float64() < f.exhaustedRate {
+		return grpc.Errorf(codes.ResourceExhausted, "injected resource exhaustion")
+	}
+	return nil
+}
@@ -1,12 +1,28 @@
 // dummymetron: a program that accepts envelopes via UDP (v1) and gRPC (v2).
 //
+// The received, errored and truncated counts of each listener are served as
+// JSON on /counters.
+//
+// By default the envelopes are thrown away. In capture mode they are decoded
+// and counted by type and source ID. The counts are served as JSON on
+// /stats and the most recent envelopes on /envelopes. The envelopes can also
+// be dumped as JSON lines to a file or stdout.
+//
+// To simulate a misbehaving agent, faults can be injected: latency on the
+// gRPC ingress, slow reads, random stream resets, RESOURCE_EXHAUSTED errors
+// and periodic listener restarts.
+//
 package main
 
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"time"
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
@@ -14,36 +30,79 @@ import (
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"code.cloudfoundry.org/loggregator/plumbing"
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
 )
 
 var (
-	udpPort  = flag.Int("udp-port", 12345, "port to use to listen for UDP (v1)")
-	grpcPort = flag.Int("grpc-port", 12345, "port to use to listen for gRPC (v2)")
-	certFile = flag.String("cert", "", "cert to use to listen for gRPC")
-	keyFile  = flag.String("key", "", "key to use to listen for gRPC")
-	caFile   = flag.String("ca", "", "ca cert to use to listen for gRPC")
+	udpPort       = flag.Int("udp-port", 3457, "port to use to listen for UDP (v1)")
+	udpBufferSize = flag.Int("udp-buffer-size", 65536, "size of the buffer UDP datagrams are read into")
+	grpcPort      = flag.Int("grpc-port", 3458, "port to use to listen for gRPC (v2)")
+	certFile      = flag.String("cert", "", "cert to use to listen for gRPC")
+	keyFile       = flag.String("key", "", "key to use to listen for gRPC")
+	caFile        = flag.String("ca", "", "ca cert to use to listen for gRPC")
+
+	capture      = flag.Bool("capture", false, "decode and record the envelopes")
+	captureLimit = flag.Int("capture-limit", 1000, "the number of recent envelopes to keep in capture mode")
+	dumpPath     = flag.String("dump", "", "file to dump the envelopes to as JSON lines in capture mode, - for stdout")
+	httpAddr     = flag.String("http-addr", "localhost:8080", "the host:port to serve /counters, and /stats and /envelopes in capture mode, on")
+
+	latency         = flag.Duration("latency", 0, "delay before handling each gRPC Send request and stream")
+	slowRead        = flag.Duration("slow-read", 0, "delay before each read from a gRPC stream or UDP")
+	resetRate       = flag.Float64("reset-rate", 0, "probability of resetting a gRPC stream with UNAVAILABLE after each read")
+	exhaustedRate   = flag.Float64("exhausted-rate", 0, "probability of failing a gRPC read or Send request with RESOURCE_EXHAUSTED")
+	restartInterval = flag.Duration("restart-interval", 0, "how often to close and reopen the listeners, 0 disables restarts")
+	restartDowntime = flag.Duration("restart-downtime", time.Second, "how long the listeners stay closed on restart")
 )
 
 func main() {
 	flag.Parse()
 
+	c := &counters{}
+	mux := http.NewServeMux()
+	mux.Handle("/counters", c)
+
+	var rec *recorder
+	if *capture {
+		rec = newCaptureRecorder()
+		mux.Handle("/stats", rec)
+		mux.Handle("/envelopes", rec)
+	}
+
+	go func() {
+		log.Printf("Serving counters on %s", *httpAddr)
+		log.Fatal(http.ListenAndServe(*httpAddr, mux))
+	}()
+
+	f := faults{
+		latency:         *latency,
+		slowRead:        *slowRead,
+		resetRate:       *resetRate,
+		exhaustedRate:   *exhaustedRate,
+		restartInterval: *restartInterval,
+		restartDowntime: *restartDowntime,
+	}
+
 	// v1
-	{
-		connection, err := net.ListenPacket("udp4", fmt.Sprintf(":%d", *udpPort))
-		if err != nil {
-			log.Fatal(err)
-		}
-		log.Printf("Listening on %s", connection.LocalAddr().String())
-		go func() {
-			b := make([]byte, 1024)
-			for {
-				_, _, err := connection.ReadFrom(b)
-				if err != nil {
-					log.Print(err)
-				}
+	go func() {
+		for {
+			connection, err := net.ListenPacket("udp4", fmt.Sprintf(":%d", *udpPort))
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Listening on %s", connection.LocalAddr().String())
+			if f.restartInterval > 0 {
+				time.AfterFunc(f.restartInterval, func() { connection.Close() })
 			}
-		}()
-	}
+
+			err = readUDP(connection, &c.UDP, rec, f)
+			if f.restartInterval == 0 {
+				log.Fatal(err)
+			}
+			log.Printf("Restarting UDP listener in %s", f.restartDowntime)
+			time.Sleep(f.restartDowntime)
+		}
+	}()
 
 	// v2
 	{
@@ -57,39 +116,154 @@ func main() {
 		}
 		transportCreds := credentials.NewTLS(tlsConfig)
 
-		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", *grpcPort))
+		for {
+			listener, err := net.Listen("tcp", fmt.Sprintf(":%d", *grpcPort))
+			if err != nil {
+				log.Fatal(err)
+			}
+			grpcServer := grpc.NewServer(grpc.Creds(transportCreds))
+			loggregator_v2.RegisterIngressServer(grpcServer, &Server{
+				counters: &c.GRPC,
+				recorder: rec,
+				faults:   f,
+			})
+			if f.restartInterval > 0 {
+				time.AfterFunc(f.restartInterval, grpcServer.Stop)
+			}
+
+			log.Printf("Starting gRPC server on %s", listener.Addr().String())
+			err = grpcServer.Serve(listener)
+			if f.restartInterval == 0 {
+				log.Fatal(err)
+			}
+			log.Printf("Restarting gRPC server in %s", f.restartDowntime)
+			time.Sleep(f.restartDowntime)
+		}
+	}
+}
+
+// readUDP reads v1 envelopes from conn until it is closed. A datagram that
+// fills the whole buffer may have been truncated.
+func readUDP(conn net.PacketConn, c *listenerCounters, rec *recorder, f faults) error {
+	b := make([]byte, *udpBufferSize)
+	for {
+		f.read()
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				log.Print(err)
+				c.errored()
+				continue
+			}
+			return err
+		}
+		c.received(1)
+		if n == len(b) {
+			c.truncated()
+		}
+		if rec == nil {
+			continue
+		}
+
+		var env events.Envelope
+		err = proto.Unmarshal(b[:n], &env)
+		if err != nil {
+			log.Printf("failed to decode v1 envelope: %s", err)
+			c.errored()
+			continue
+		}
+		rec.RecordV1(&env)
+	}
+}
+
+// newCaptureRecorder builds the recorder for capture mode.
+func newCaptureRecorder() *recorder {
+	var dump io.Writer
+	switch *dumpPath {
+	case "":
+	case "-":
+		dump = os.Stdout
+	default:
+		f, err := os.Create(*dumpPath)
 		if err != nil {
 			log.Fatal(err)
 		}
-		grpcServer := grpc.NewServer(grpc.Creds(transportCreds))
-		loggregator_v2.RegisterIngressServer(grpcServer, &Server{})
-		log.Printf("Starting gRPC server on %s", listener.Addr().String())
-		log.Fatal(grpcServer.Serve(listener))
+		dump = f
 	}
+
+	return newRecorder(*captureLimit, dump)
 }
 
-type Server struct{}
+// Server accepts v2 envelopes. If recorder is not nil the envelopes are
+// recorded.
+type Server struct {
+	counters *listenerCounters
+	recorder *recorder
+	faults   faults
+}
 
 func (s *Server) Sender(server loggregator_v2.Ingress_SenderServer) error {
+	s.faults.respond()
 	for {
-		_, err := server.Recv()
+		s.faults.read()
+		env, err := server.Recv()
 		if err != nil {
-			log.Print(err)
+			s.recvFailed(err)
 			return nil
 		}
+		s.counters.received(1)
+		if s.recorder != nil {
+			s.recorder.RecordV2(env)
+		}
+
+		if err := s.faults.streamErr(); err != nil {
+			return err
+		}
 	}
 }
 
 func (s *Server) BatchSender(server loggregator_v2.Ingress_BatchSenderServer) error {
+	s.faults.respond()
 	for {
-		_, err := server.Recv()
+		s.faults.read()
+		batch, err := server.Recv()
 		if err != nil {
-			log.Print(err)
+			s.recvFailed(err)
 			return nil
 		}
+		s.record(batch)
+
+		if err := s.faults.streamErr(); err != nil {
+			return err
+		}
 	}
 }
 
-func (s *Server) Send(context.Context, *loggregator_v2.EnvelopeBatch) (*loggregator_v2.SendResponse, error) {
-	return nil, nil
+func (s *Server) Send(_ context.Context, batch *loggregator_v2.EnvelopeBatch) (*loggregator_v2.SendResponse, error) {
+	s.faults.respond()
+	if err := s.faults.requestErr(); err != nil {
+		return nil, err
+	}
+	s.record(batch)
+	return &loggregator_v2.SendResponse{}, nil
+}
+
+func (s *Server) record(batch *loggregator_v2.EnvelopeBatch) {
+	s.counters.received(len(batch.GetBatch()))
+	if s.recorder == nil {
+		return
+	}
+	for _, env := range batch.GetBatch() {
+		s.recorder.RecordV2(env)
+	}
+}
+
+// recvFailed counts the error that ended a stream, unless the client closed
+// it.
+func (s *Server) recvFailed(err error) {
+	if err == io.EOF {
+		return
+	}
+	log.Print(err)
+	s.counters.errored()
 }
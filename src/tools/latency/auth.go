@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// tokenRefreshMargin is how long before a token expires that it is
+// refreshed.
+const tokenRefreshMargin = time.Minute
+
+// tokenSource returns the token used to read logs.
+type tokenSource interface {
+	Token() (string, error)
+	// RefreshAuthToken returns a new token. It implements
+	// consumer.TokenRefresher.
+	RefreshAuthToken() (string, error)
+}
+
+// newTLSConfig builds the TLS config used to connect to the traffic
+// controller, the gateway and UAA. Certificates are verified against the
+// system roots and the PEM encoded CA_CERT, unless SKIP_CERT_VERIFY is true.
+func newTLSConfig() (*tls.Config, error) {
+	c := &tls.Config{
+		InsecureSkipVerify: os.Getenv("SKIP_CERT_VERIFY") == "true",
+	}
+
+	if ca := os.Getenv("CA_CERT"); ca != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(ca)) {
+			return nil, errors.New("invalid CA_CERT")
+		}
+		c.RootCAs = pool
+	}
+
+	return c, nil
+}
+
+// newTokenSource returns a token source that fetches tokens from UAA with
+// the client credentials grant when UAA_ADDR, CLIENT_ID and CLIENT_SECRET
+// are set. Otherwise it returns the static TOKEN.
+func newTokenSource(tlsConfig *tls.Config) (tokenSource, error) {
+	uaaAddr := os.Getenv("UAA_ADDR")
+	if uaaAddr == "" {
+		token := os.Getenv("TOKEN")
+		if token == "" {
+			return nil, errors.New("empty token")
+		}
+		return staticToken(token), nil
+	}
+
+	clientID := os.Getenv("CLIENT_ID")
+	clientSecret := os.Getenv("CLIENT_SECRET")
+	if clientID == "" || clientSecret == "" {
+		return nil, errors.New("UAA_ADDR requires CLIENT_ID and CLIENT_SECRET")
+	}
+
+	return &uaaTokenSource{
+		uaaAddr:      uaaAddr,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}, nil
+}
+
+type staticToken string
+
+func (t staticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+func (t staticToken) RefreshAuthToken() (string, error) {
+	return t.Token()
+}
+
+// uaaTokenSource fetches tokens from UAA and caches them until shortly
+// before they expire.
+type uaaTokenSource struct {
+	uaaAddr      string
+	clientID     string
+	clientSecret string
+	httpClient   *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (s *uaaTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Add(tokenRefreshMargin).Before(s.expires) {
+		return s.token, nil
+	}
+	return s.refresh()
+}
+
+func (s *uaaTokenSource) RefreshAuthToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.refresh()
+}
+
+func (s *uaaTokenSource) refresh() (string, error) {
+	response, err := s.httpClient.PostForm(s.uaaAddr+"/oauth/token", url.Values{
+		"response_type": {"token"},
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.clientID},
+		"client_secret": {s.clientSecret},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("expected 200 status code from /oauth/token, got %d", response.StatusCode)
+	}
+
+	var oauthResponse struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&oauthResponse)
+	if err != nil {
+		return "", err
+	}
+	if oauthResponse.AccessToken == "" {
+		return "", errors.New("no access_token on UAA oauth response")
+	}
+
+	s.token = "bearer " + oauthResponse.AccessToken
+	s.expires = time.Now().Add(time.Duration(oauthResponse.ExpiresIn) * time.Second)
+	return s.token, nil
+}
@@ -6,8 +6,25 @@ function target_url {
     cf curl /v2/info | \
         python -c 'import json, sys; print json.load(sys.stdin).get("doppler_logging_endpoint")'
 }
+
+function uaa_url {
+    cf curl /v2/info | \
+        python -c 'import json, sys; print json.load(sys.stdin).get("token_endpoint")'
+}
 app_name=${1:-loggregator-latency}
 cf push "$app_name" -b binary_buildpack --no-start -m 64M -c ./latency
 cf set-env "$app_name" TARGET_URL "$(target_url)"
-cf set-env "$app_name" TOKEN "$(cf oauth-token)"
+if [ -n "$CLIENT_ID" ]; then
+    cf set-env "$app_name" UAA_ADDR "$(uaa_url)"
+    cf set-env "$app_name" CLIENT_ID "$CLIENT_ID"
+    cf set-env "$app_name" CLIENT_SECRET "$CLIENT_SECRET"
+else
+    cf set-env "$app_name" TOKEN "$(cf oauth-token)"
+fi
+if [ -n "$CA_CERT" ]; then
+    cf set-env "$app_name" CA_CERT "$CA_CERT"
+fi
+if [ -n "$SKIP_CERT_VERIFY" ]; then
+    cf set-env "$app_name" SKIP_CERT_VERIFY "$SKIP_CERT_VERIFY"
+fi
 cf start "$app_name"
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,12 +10,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
-
-	"github.com/cloudfoundry/noaa/consumer"
-	"github.com/cloudfoundry/sonde-go/events"
-	uuid "github.com/nu7hatch/gouuid"
 )
 
 const (
@@ -24,55 +18,90 @@ const (
 	readAttempts        = 5
 	readAttemptDuration = time.Second
 	messagePrefix       = "loggregator-latency-test-"
+
+	defaultProbeInterval = time.Second
+	defaultProbeTimeout  = 10 * time.Second
+	defaultProbeWindow   = 5 * time.Minute
 )
 
 func main() {
 	log.SetOutput(os.Stdout)
 
-	addr, token, location, origin, err := input()
+	addr, location, origin, err := input()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokens, err := newTokenSource(tlsConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	appID, err := appID()
+	if err != nil {
+		log.Fatalf("invalid VCAP_APPLICATION: %s", err)
+	}
+
+	streamers, err := streamers(location, tokens, tlsConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	managers := make(map[string]*sessionManager)
+	for name, s := range streamers {
+		managers[name] = newSessionManager(s, name, appID)
+		go managers[name].Run()
+	}
+
+	probers, err := probers(managers)
 	if err != nil {
 		log.Fatal(err)
 	}
+	for _, p := range probers {
+		go p.Run()
+	}
 
 	mux := &http.ServeMux{}
 	mux.Handle("/", &healthHandler{})
 	mux.Handle("/latency", &latencyHandler{
-		location: location,
 		origin:   origin,
-		token:    token,
+		managers: managers,
+	})
+	mux.Handle("/metrics", &metricsHandler{
+		probers: probers,
 	})
 
 	server := &http.Server{
 		Addr:           addr,
 		Handler:        mux,
 		ReadTimeout:    5 * time.Second,
-		WriteTimeout:   10 * time.Second,
+		WriteTimeout:   maxTestDuration + readAttempts*readAttemptDuration + 10*time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
 	log.Print("listening on " + addr)
 	log.Fatal(server.ListenAndServe())
 }
 
-func input() (addr, token string, location, origin *url.URL, err error) {
+func input() (addr string, location, origin *url.URL, err error) {
 	targetURL := os.Getenv("TARGET_URL")
 	if targetURL == "" {
-		return "", "", nil, nil, errors.New("empty target url")
-	}
-
-	token = os.Getenv("TOKEN")
-	if token == "" {
-		return "", "", nil, nil, errors.New("empty token")
+		return "", nil, nil, errors.New("empty target url")
 	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
-		return "", "", nil, nil, errors.New("empty port")
+		return "", nil, nil, errors.New("empty port")
 	}
 	addr = ":" + port
 
 	location, err = url.Parse(targetURL)
 	if err != nil {
-		return "", "", nil, nil, fmt.Errorf("invalid target url: %s", err)
+		return "", nil, nil, fmt.Errorf("invalid target url: %s", err)
 	}
 	// This shallow copies location, which is enough to create an origin URL.
 	originLocal := *location
@@ -83,11 +112,69 @@ func input() (addr, token string, location, origin *url.URL, err error) {
 	case "wss":
 		originLocal.Scheme = "https"
 	default:
-		return "", "", nil, nil, errors.New("target url requires a scheme of ws or wss")
+		return "", nil, nil, errors.New("target url requires a scheme of ws or wss")
 	}
 	origin = &originLocal
 
-	return addr, token, location, origin, nil
+	return addr, location, origin, nil
+}
+
+// probers builds a prober for each stream in PROBE_STREAMS (default v1).
+// PROBE_INTERVAL sets how often a probe message is written, and disables
+// probing when 0. PROBE_TIMEOUT sets how long until a probe message is lost
+// and PROBE_WINDOW the length of the rolling window that is reported.
+func probers(managers map[string]*sessionManager) ([]*prober, error) {
+	interval, err := durationEnv("PROBE_INTERVAL", defaultProbeInterval)
+	if err != nil {
+		return nil, err
+	}
+	if interval < 0 {
+		return nil, errors.New("PROBE_INTERVAL must not be negative")
+	}
+	if interval == 0 {
+		return nil, nil
+	}
+
+	timeout, err := durationEnv("PROBE_TIMEOUT", defaultProbeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if timeout < 0 {
+		return nil, errors.New("PROBE_TIMEOUT must not be negative")
+	}
+
+	window, err := durationEnv("PROBE_WINDOW", defaultProbeWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	names := defaultStream
+	if s := os.Getenv("PROBE_STREAMS"); s != "" {
+		names = s
+	}
+
+	var probers []*prober
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		m, ok := managers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or unconfigured probe stream: %q", name)
+		}
+		probers = append(probers, newProber(m, name, interval, timeout, window))
+	}
+	return probers, nil
+}
+
+func durationEnv(name string, defaultValue time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", name, err)
+	}
+	return d, nil
 }
 
 func appID() (string, error) {
@@ -111,22 +198,55 @@ func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 type latencyHandler struct {
-	location *url.URL
 	origin   *url.URL
-	token    string
+	managers map[string]*sessionManager
 }
 
+// ServeHTTP runs a latency test and writes a latencyReport as JSON. The
+// stream query parameter selects how the logs are read back, see streamers.
+// The histogram query parameter adds histogram buckets to the report. The
+// legacy query parameter writes only the mean latency in seconds instead.
 func (h *latencyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	sampleSize := sampleSize(r)
+	params, err := parseTestParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := r.URL.Query().Get("stream")
+	if name == "" {
+		name = defaultStream
+	}
+	m, ok := h.managers[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown or unconfigured stream: %q", name), http.StatusBadRequest)
+		return
+	}
 
-	avg, err := h.executeLatencyTest(sampleSize)
+	samples, err := executeLatencyTest(m, params)
 	if err != nil {
 		log.Printf("sample failed: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	fmt.Fprintf(w, "%f\n", avg.Seconds())
+	report := computeSizeReport(samples, params.sent(), boolQuery(r, "histogram"))
+
+	if boolQuery(r, "legacy") {
+		if report.Count == 0 {
+			log.Print("sample failed: no results")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "%f\n", report.Mean)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(report)
+	if err != nil {
+		log.Printf("failed to write report: %s", err)
+	}
 }
 
 func sampleSize(r *http.Request) int {
@@ -135,114 +255,59 @@ func sampleSize(r *http.Request) int {
 		return defaultSampleSize
 	}
 	sampleSize, err := strconv.Atoi(samplesQuery)
-	if err != nil || sampleSize < 1 || sampleSize > 1000 {
+	if err != nil || sampleSize < 1 || sampleSize > maxSampleSize {
 		return defaultSampleSize
 	}
 	return sampleSize
 }
 
-func (h *latencyHandler) executeLatencyTest(sampleQuantity int) (time.Duration, error) {
-	sendTimes := make(map[string]time.Time)
-	results := make(map[string]time.Duration)
-
-	appID, _ := appID()
-	consumer := consumer.New(h.location.String(), &tls.Config{InsecureSkipVerify: true}, nil)
-	consumer.SetDebugPrinter(ConsoleDebugPrinter{})
-	msgChan, errorChan := consumer.Stream(appID, h.token)
-	defer consumer.Close()
-
-	go func() {
-		for err := range errorChan {
-			if err == nil {
-				return
-			}
-			log.Println(err)
-		}
-	}()
-
-Loop:
-	for {
-		select {
-		case envelope := <-msgChan:
-			if envelope.GetEventType() == events.Envelope_LogMessage {
-				message := string(envelope.GetLogMessage().GetMessage())
+func boolQuery(r *http.Request, name string) bool {
+	b, _ := strconv.ParseBool(r.URL.Query().Get(name))
+	return b
+}
 
-				if message == "ENSURE CONNECTION" {
-					break Loop
-				}
-			}
-		default:
-			fmt.Println("ENSURE CONNECTION")
-			time.Sleep(250 * time.Millisecond)
-		}
+// executeLatencyTest writes the messages of a test in a new session and
+// returns the samples of those read back before the stream stays quiet for
+// the test's interval and timeout.
+func executeLatencyTest(m *sessionManager, params testParams) ([]sample, error) {
+	err := m.WaitReady(readAttempts * readAttemptDuration)
+	if err != nil {
+		return nil, err
 	}
 
-	var mutex sync.RWMutex
+	session := m.Open(params.Samples)
+	defer session.Close()
+
 	go func() {
-		for i := 0; i < sampleQuantity; i++ {
-			sampleMessage := generateRandomMessage()
-			mutex.Lock()
-			sendTimes[sampleMessage] = time.Now()
-			fmt.Println(sampleMessage)
-			mutex.Unlock()
-			time.Sleep(1 * time.Millisecond)
+		for i := 0; i < params.Samples; i++ {
+			session.Send(params.size(i))
+			time.Sleep(params.Interval)
 		}
 	}()
 
-	timer := time.NewTimer(readAttemptDuration)
+	wait := params.Interval + params.Timeout
+	results := make([]sample, 0, params.Samples)
+	timer := time.NewTimer(wait)
 	for {
 		select {
-		case envelope := <-msgChan:
-			end := time.Now()
-
-			if envelope.GetEventType() == events.Envelope_LogMessage {
-				message := string(envelope.GetLogMessage().GetMessage())
-
-				if strings.Contains(message, messagePrefix) {
-					mutex.RLock()
-					start, ok := sendTimes[message]
-					mutex.RUnlock()
-
-					if ok {
-						results[message] = end.Sub(start)
-					}
-				}
-			}
-
-			if len(results) == sampleQuantity {
-				return computeAverages(results)
+		case s := <-session.Samples():
+			results = append(results, s)
+			if len(results) == params.Samples {
+				return results, nil
 			}
 
 			if !timer.Stop() {
 				<-timer.C
 			}
-			timer.Reset(readAttemptDuration)
+			timer.Reset(wait)
 		case <-timer.C:
-			lost := sampleQuantity - len(results)
+			lost := params.Samples - len(results)
 			log.Printf("Test timeout expired with %d messages lost.", lost)
-			return computeAverages(results)
+			return results, nil
 		}
 	}
 }
 
-func computeAverages(results map[string]time.Duration) (time.Duration, error) {
-	if len(results) == 0 {
-		return 0, errors.New("No results.")
-	}
-
-	var totalDuration time.Duration
-	for _, d := range results {
-		totalDuration += d
-	}
-
-	return totalDuration / time.Duration(len(results)), nil
-}
-
-func generateRandomMessage() string {
-	id, _ := uuid.NewV4()
-	return fmt.Sprint(messagePrefix, id.String())
-}
-
 type ConsoleDebugPrinter struct{}
 
 func (c ConsoleDebugPrinter) Print(title, dump string) {
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxSampleSize   = 1000
+	maxMessageSize  = 64 * 1024
+	maxTestDuration = 2 * time.Minute
+
+	// minMessageSize fits the longest tagged message, made of the prefix,
+	// a session UUID and the sequence number of the last sample, and at
+	// least one byte of padding after a space.
+	minMessageSize = len(messagePrefix) + len("00000000-0000-0000-0000-000000000000:999 x")
+)
+
+// testParams configure a latency test.
+type testParams struct {
+	// Samples is the number of messages written.
+	Samples int
+	// Sizes are the sizes of the messages in bytes. The messages cycle
+	// through the sizes. Sizes must fit the tagged message, so that each
+	// message is sent at exactly its size.
+	Sizes []int
+	// Interval is how long to wait between writing messages.
+	Interval time.Duration
+	// Timeout is how long to wait, beyond the interval, for the next message
+	// to be read back before the remaining messages are counted as lost.
+	Timeout time.Duration
+}
+
+// parseTestParams reads the test parameters from a JSON body of the form
+//
+//	{"samples": 10, "sizes": [100, 1000], "interval": "1ms", "timeout": "1s"}
+//
+// or else from the samples, size (comma separated), interval and timeout
+// query parameters. An invalid samples query parameter uses the default.
+func parseTestParams(r *http.Request) (testParams, error) {
+	p := testParams{
+		Samples:  defaultSampleSize,
+		Sizes:    []int{minMessageSize},
+		Interval: time.Millisecond,
+		Timeout:  readAttemptDuration,
+	}
+
+	if r.Method == http.MethodPost && r.ContentLength != 0 {
+		err := p.decodeJSON(r)
+		if err != nil {
+			return testParams{}, err
+		}
+		return p, p.validate()
+	}
+
+	p.Samples = sampleSize(r)
+
+	q := r.URL.Query()
+	if sizes := q.Get("size"); sizes != "" {
+		p.Sizes = nil
+		for _, s := range strings.Split(sizes, ",") {
+			size, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return testParams{}, fmt.Errorf("invalid size: %s", err)
+			}
+			p.Sizes = append(p.Sizes, size)
+		}
+	}
+
+	var err error
+	if interval := q.Get("interval"); interval != "" {
+		p.Interval, err = time.ParseDuration(interval)
+		if err != nil {
+			return testParams{}, fmt.Errorf("invalid interval: %s", err)
+		}
+	}
+
+	if timeout := q.Get("timeout"); timeout != "" {
+		p.Timeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return testParams{}, fmt.Errorf("invalid timeout: %s", err)
+		}
+	}
+
+	return p, p.validate()
+}
+
+func (p *testParams) decodeJSON(r *http.Request) error {
+	var body struct {
+		Samples  *int   `json:"samples"`
+		Sizes    []int  `json:"sizes"`
+		Interval string `json:"interval"`
+		Timeout  string `json:"timeout"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return fmt.Errorf("invalid body: %s", err)
+	}
+
+	if body.Samples != nil {
+		p.Samples = *body.Samples
+	}
+	if len(body.Sizes) > 0 {
+		p.Sizes = body.Sizes
+	}
+	if body.Interval != "" {
+		p.Interval, err = time.ParseDuration(body.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid interval: %s", err)
+		}
+	}
+	if body.Timeout != "" {
+		p.Timeout, err = time.ParseDuration(body.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout: %s", err)
+		}
+	}
+	return nil
+}
+
+func (p testParams) validate() error {
+	if p.Samples < 1 || p.Samples > maxSampleSize {
+		return fmt.Errorf("samples must be between 1 and %d", maxSampleSize)
+	}
+	for _, s := range p.Sizes {
+		if s < minMessageSize || s > maxMessageSize {
+			return fmt.Errorf("sizes must be between %d and %d", minMessageSize, maxMessageSize)
+		}
+	}
+	if p.Interval < 0 {
+		return errors.New("interval must not be negative")
+	}
+	if p.Timeout <= 0 {
+		return errors.New("timeout must be positive")
+	}
+	if time.Duration(p.Samples)*p.Interval+p.Timeout > maxTestDuration {
+		return fmt.Errorf("samples * interval + timeout must not exceed %s", maxTestDuration)
+	}
+	return nil
+}
+
+// size returns the size of the i-th message.
+func (p testParams) size(i int) int {
+	return p.Sizes[i%len(p.Sizes)]
+}
+
+// sent returns how many messages of each size are written.
+func (p testParams) sent() map[int]int {
+	sent := make(map[int]int)
+	for i := 0; i < p.Samples; i++ {
+		sent[p.size(i)]++
+	}
+	return sent
+}
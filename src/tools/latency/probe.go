@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// prober continuously writes probe messages in a session and measures how
+// long they take to be read back. Probe messages that are not read back
+// within the timeout are counted as lost. Only the samples within the
+// rolling window are reported.
+type prober struct {
+	m        *sessionManager
+	name     string
+	interval time.Duration
+	timeout  time.Duration
+	window   time.Duration
+
+	mu      sync.Mutex
+	samples []probeSample
+}
+
+type probeSample struct {
+	at     time.Time
+	sample sample
+	lost   bool
+}
+
+func newProber(m *sessionManager, name string, interval, timeout, window time.Duration) *prober {
+	return &prober{
+		m:        m,
+		name:     name,
+		interval: interval,
+		timeout:  timeout,
+		window:   window,
+	}
+}
+
+// Run writes probe messages and reads them back once the stream is
+// connected, so that probes are not lost before it is. Run does not return.
+func (p *prober) Run() {
+	for {
+		err := p.m.WaitReady(readAttempts * readAttemptDuration)
+		if err == nil {
+			break
+		}
+		log.Printf("probe: %s", err)
+	}
+
+	session := p.m.Open(int(p.timeout/p.interval) + 1)
+	defer session.Close()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case sample := <-session.Samples():
+			p.mu.Lock()
+			p.samples = append(p.samples, probeSample{
+				at:     time.Now(),
+				sample: sample,
+			})
+			p.mu.Unlock()
+		case <-ticker.C:
+			session.Send(0)
+
+			lost := session.Expire(p.timeout)
+			p.mu.Lock()
+			for i := 0; i < lost; i++ {
+				p.samples = append(p.samples, probeSample{
+					at:   time.Now(),
+					lost: true,
+				})
+			}
+			p.expire(time.Now())
+			p.mu.Unlock()
+		}
+	}
+}
+
+// expire drops the samples that are outside the window. It must be called
+// with mu held.
+func (p *prober) expire(now time.Time) {
+	var i int
+	for i < len(p.samples) && now.Sub(p.samples[i].at) > p.window {
+		i++
+	}
+	p.samples = p.samples[i:]
+}
+
+// report returns the latencies and the number of lost messages within the
+// window.
+func (p *prober) report() latencyReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire(time.Now())
+
+	var samples []sample
+	for _, s := range p.samples {
+		if !s.lost {
+			samples = append(samples, s.sample)
+		}
+	}
+	return computeSampleReport(samples, len(p.samples), false)
+}
+
+// metricsHandler writes the probe results in the Prometheus text format.
+type metricsHandler struct {
+	probers []*prober
+}
+
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	reports := make([]latencyReport, len(h.probers))
+	for i, p := range h.probers {
+		reports[i] = p.report()
+	}
+
+	fmt.Fprintln(w, "# HELP loggregator_latency_probe_seconds Latency of probe messages within the rolling window.")
+	fmt.Fprintln(w, "# TYPE loggregator_latency_probe_seconds summary")
+	for i, p := range h.probers {
+		writeSummary(w, "loggregator_latency_probe_seconds", fmt.Sprintf("stream=%q", p.name), reports[i])
+	}
+
+	fmt.Fprintln(w, "# HELP loggregator_latency_probe_leg_seconds Latency of each leg of probe messages within the rolling window.")
+	fmt.Fprintln(w, "# TYPE loggregator_latency_probe_leg_seconds summary")
+	for i, p := range h.probers {
+		legs := reports[i].Legs
+		if legs == nil {
+			continue
+		}
+		for _, l := range []struct {
+			leg string
+			r   latencyReport
+		}{
+			{"ingest", legs.Ingest},
+			{"delivery", legs.Delivery},
+		} {
+			writeSummary(w, "loggregator_latency_probe_leg_seconds", fmt.Sprintf("stream=%q,leg=%q", p.name, l.leg), l.r)
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP loggregator_latency_probe_lost Probe messages lost within the rolling window.")
+	fmt.Fprintln(w, "# TYPE loggregator_latency_probe_lost gauge")
+	for i, p := range h.probers {
+		fmt.Fprintf(w, "loggregator_latency_probe_lost{stream=%q} %d\n", p.name, reports[i].Lost)
+	}
+
+	fmt.Fprintln(w, "# HELP loggregator_latency_probe_loss_ratio Ratio of probe messages lost within the rolling window.")
+	fmt.Fprintln(w, "# TYPE loggregator_latency_probe_loss_ratio gauge")
+	for i, p := range h.probers {
+		var ratio float64
+		if total := reports[i].Count + reports[i].Lost; total > 0 {
+			ratio = float64(reports[i].Lost) / float64(total)
+		}
+		fmt.Fprintf(w, "loggregator_latency_probe_loss_ratio{stream=%q} %g\n", p.name, ratio)
+	}
+
+	fmt.Fprintln(w, "# HELP loggregator_latency_probe_window_seconds Length of the rolling window.")
+	fmt.Fprintln(w, "# TYPE loggregator_latency_probe_window_seconds gauge")
+	for _, p := range h.probers {
+		fmt.Fprintf(w, "loggregator_latency_probe_window_seconds{stream=%q} %g\n", p.name, p.window.Seconds())
+	}
+}
+
+// writeSummary writes the quantiles, sum and count of a summary metric with
+// the given labels.
+func writeSummary(w io.Writer, name, labels string, r latencyReport) {
+	for _, q := range []struct {
+		quantile string
+		value    float64
+	}{
+		{"0.5", r.P50},
+		{"0.9", r.P90},
+		{"0.95", r.P95},
+		{"0.99", r.P99},
+	} {
+		fmt.Fprintf(w, "%s{%s,quantile=%q} %g\n", name, labels, q.quantile, q.value)
+	}
+	fmt.Fprintf(w, "%s_sum{%s} %g\n", name, labels, r.Mean*float64(r.Count))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, r.Count)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionManager multiplexes latency test sessions over one long-lived
+// stream. Each session tags the messages it writes with its ID, so the
+// manager can route each message read from the stream back to the session
+// that wrote it.
+type sessionManager struct {
+	stream streamer
+	name   string
+	appID  string
+
+	mu       sync.Mutex
+	ready    chan struct{}
+	sessions map[string]*session
+}
+
+func newSessionManager(stream streamer, name, appID string) *sessionManager {
+	return &sessionManager{
+		stream:   stream,
+		name:     name,
+		appID:    appID,
+		ready:    make(chan struct{}),
+		sessions: make(map[string]*session),
+	}
+}
+
+// Run opens the stream and routes the messages read from it to the
+// sessions. The stream is reopened whenever it ends. Run does not return.
+func (m *sessionManager) Run() {
+	for {
+		err := m.run()
+		log.Printf("%s stream ended: %s", m.name, err)
+
+		m.mu.Lock()
+		m.ready = make(chan struct{})
+		m.mu.Unlock()
+
+		time.Sleep(time.Second)
+	}
+}
+
+func (m *sessionManager) run() error {
+	msgs, closeStream, err := m.stream.Stream(m.appID)
+	if err != nil {
+		return err
+	}
+	defer closeStream()
+
+	err = ensureConnection(msgs)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	close(m.ready)
+	m.mu.Unlock()
+
+	for msg := range msgs {
+		end := time.Now()
+
+		id, ok := sessionID(msg.payload)
+		if !ok {
+			continue
+		}
+
+		m.mu.Lock()
+		s, ok := m.sessions[id]
+		m.mu.Unlock()
+
+		if ok {
+			s.receive(msg, end)
+		}
+	}
+	return errors.New("stream closed")
+}
+
+// ensureConnection writes messages until one is read back from the stream.
+func ensureConnection(msgs <-chan logMessage) error {
+	for {
+		select {
+		case message, ok := <-msgs:
+			if !ok {
+				return errors.New("stream closed")
+			}
+			if message.payload == "ENSURE CONNECTION" {
+				return nil
+			}
+		default:
+			fmt.Println("ENSURE CONNECTION")
+			time.Sleep(250 * time.Millisecond)
+		}
+	}
+}
+
+// WaitReady waits until the stream is connected.
+func (m *sessionManager) WaitReady(timeout time.Duration) error {
+	m.mu.Lock()
+	ready := m.ready
+	m.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("%s stream is not connected", m.name)
+	}
+}
+
+// Open starts a new session. At most size samples are buffered for the
+// session, any more are dropped until they are read.
+func (m *sessionManager) Open(size int) *session {
+	s := &session{
+		id:      randomID(),
+		m:       m,
+		sent:    make(map[string]sentMessage),
+		samples: make(chan sample, size),
+	}
+
+	m.mu.Lock()
+	m.sessions[s.id] = s
+	m.mu.Unlock()
+
+	return s
+}
+
+// session writes messages tagged with its ID and receives a sample for
+// each that is read back from the stream.
+type session struct {
+	id string
+	m  *sessionManager
+
+	mu      sync.Mutex
+	seq     int
+	sent    map[string]sentMessage
+	samples chan sample
+}
+
+type sentMessage struct {
+	at   time.Time
+	size int
+}
+
+// sample is the latency of a message read back from the stream. When the
+// envelope of the message has a timestamp the latency is split into two
+// legs: ingest, from the write to the envelope timestamp, and delivery, from
+// the envelope timestamp to the read. Since the app and the agent that
+// timestamps its logs run on the same cell, both legs are measured against
+// the same clock.
+type sample struct {
+	latency  time.Duration
+	ingest   time.Duration
+	delivery time.Duration
+	legs     bool
+	size     int
+}
+
+// Send writes a new message for the session. The message is padded to size
+// bytes, unless size is smaller than the tagged message.
+func (s *session) Send(size int) {
+	s.mu.Lock()
+	msg := fmt.Sprintf("%s%s:%d", messagePrefix, s.id, s.seq)
+	if pad := size - len(msg) - 1; pad > 0 {
+		msg += " " + strings.Repeat("x", pad)
+	}
+	s.seq++
+	s.sent[msg] = sentMessage{at: time.Now(), size: size}
+	fmt.Println(msg)
+	s.mu.Unlock()
+}
+
+// Samples returns the samples of the messages that have been read back.
+func (s *session) Samples() <-chan sample {
+	return s.samples
+}
+
+// Expire forgets the messages that were sent more than timeout ago and
+// returns how many there were.
+func (s *session) Expire(timeout time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lost int
+	now := time.Now()
+	for msg, sent := range s.sent {
+		if now.Sub(sent.at) > timeout {
+			delete(s.sent, msg)
+			lost++
+		}
+	}
+	return lost
+}
+
+// Close stops routing messages to the session.
+func (s *session) Close() {
+	s.m.mu.Lock()
+	delete(s.m.sessions, s.id)
+	s.m.mu.Unlock()
+}
+
+func (s *session) receive(msg logMessage, end time.Time) {
+	s.mu.Lock()
+	sent, ok := s.sent[msg.payload]
+	delete(s.sent, msg.payload)
+	s.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	smpl := sample{
+		latency: end.Sub(sent.at),
+		size:    sent.size,
+	}
+	if !msg.timestamp.IsZero() {
+		smpl.ingest = msg.timestamp.Sub(sent.at)
+		smpl.delivery = end.Sub(msg.timestamp)
+		smpl.legs = true
+	}
+
+	select {
+	case s.samples <- smpl:
+	default:
+	}
+}
+
+// sessionID returns the ID of the session that wrote msg.
+func sessionID(msg string) (string, bool) {
+	i := strings.Index(msg, messagePrefix)
+	if i < 0 {
+		return "", false
+	}
+	msg = msg[i+len(messagePrefix):]
+
+	j := strings.LastIndex(msg, ":")
+	if j < 0 {
+		return "", false
+	}
+	return msg[:j], true
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// histogramBounds are the upper bounds of the histogram buckets. The last
+// bucket counts everything above the largest bound.
+var histogramBounds = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// latencyReport is the distribution of latencies for a test. All durations
+// are in seconds. Legs breaks the latency down into its ingest and delivery
+// legs when the envelopes read back have timestamps. BySize breaks the
+// distribution down by message size when messages of more than one size
+// were written.
+type latencyReport struct {
+	Count     int                   `json:"count"`
+	Lost      int                   `json:"lost"`
+	Min       float64               `json:"min"`
+	Max       float64               `json:"max"`
+	Mean      float64               `json:"mean"`
+	P50       float64               `json:"p50"`
+	P90       float64               `json:"p90"`
+	P95       float64               `json:"p95"`
+	P99       float64               `json:"p99"`
+	Histogram []histogramBucket     `json:"histogram,omitempty"`
+	Legs      *legsReport           `json:"legs,omitempty"`
+	BySize    map[int]latencyReport `json:"by_size,omitempty"`
+}
+
+// legsReport is the distribution of each leg of the latency. Ingest is from
+// the write to the envelope timestamp, Delivery from the envelope timestamp
+// to the read. Lost is not counted for the legs.
+type legsReport struct {
+	Ingest   latencyReport `json:"ingest"`
+	Delivery latencyReport `json:"delivery"`
+}
+
+// histogramBucket counts the latencies up to and including LE seconds that
+// are not in a lower bucket. The last bucket has an LE of +Inf, which is
+// encoded as null.
+type histogramBucket struct {
+	LE    *float64 `json:"le"`
+	Count int      `json:"count"`
+}
+
+// computeReport builds a latencyReport from the measured latencies.
+// Histogram buckets are only included if withHistogram is set.
+func computeReport(latencies []time.Duration, lost int, withHistogram bool) latencyReport {
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	r := latencyReport{
+		Count: len(sorted),
+		Lost:  lost,
+	}
+	if len(sorted) == 0 {
+		return r
+	}
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	r.Min = sorted[0].Seconds()
+	r.Max = sorted[len(sorted)-1].Seconds()
+	r.Mean = (total / time.Duration(len(sorted))).Seconds()
+	r.P50 = percentile(sorted, 50).Seconds()
+	r.P90 = percentile(sorted, 90).Seconds()
+	r.P95 = percentile(sorted, 95).Seconds()
+	r.P99 = percentile(sorted, 99).Seconds()
+
+	if withHistogram {
+		r.Histogram = histogram(sorted)
+	}
+	return r
+}
+
+// computeSizeReport builds a latencyReport from the samples of a test,
+// broken down by message size. sent is how many messages of each size were
+// written.
+func computeSizeReport(samples []sample, sent map[int]int, withHistogram bool) latencyReport {
+	var total int
+	bySize := make(map[int][]sample)
+	for _, s := range samples {
+		bySize[s.size] = append(bySize[s.size], s)
+	}
+	for _, n := range sent {
+		total += n
+	}
+
+	r := computeSampleReport(samples, total, withHistogram)
+	if len(sent) < 2 {
+		return r
+	}
+
+	r.BySize = make(map[int]latencyReport)
+	for size, n := range sent {
+		r.BySize[size] = computeSampleReport(bySize[size], n, withHistogram)
+	}
+	return r
+}
+
+// computeSampleReport builds a latencyReport, including the legs, from the
+// samples of sent messages.
+func computeSampleReport(samples []sample, sent int, withHistogram bool) latencyReport {
+	var latencies, ingest, delivery []time.Duration
+	for _, s := range samples {
+		latencies = append(latencies, s.latency)
+		if s.legs {
+			ingest = append(ingest, s.ingest)
+			delivery = append(delivery, s.delivery)
+		}
+	}
+
+	r := computeReport(latencies, sent-len(latencies), withHistogram)
+	if len(ingest) > 0 {
+		r.Legs = &legsReport{
+			Ingest:   computeReport(ingest, 0, withHistogram),
+			Delivery: computeReport(delivery, 0, withHistogram),
+		}
+	}
+	return r
+}
+
+// percentile returns the nearest-rank percentile p of the sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func histogram(sorted []time.Duration) []histogramBucket {
+	buckets := make([]histogramBucket, len(histogramBounds)+1)
+	for i, b := range histogramBounds {
+		le := b.Seconds()
+		buckets[i].LE = &le
+	}
+
+	i := 0
+	for _, d := range sorted {
+		for i < len(histogramBounds) && d > histogramBounds[i] {
+			i++
+		}
+		buckets[i].Count++
+	}
+	return buckets
+}
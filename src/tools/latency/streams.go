@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator/plumbing"
+
+	"github.com/cloudfoundry/noaa/consumer"
+	"github.com/cloudfoundry/sonde-go/events"
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+const defaultStream = "v1"
+
+// streamer streams the log messages of an app. The returned close func stops
+// the stream and must be called once the messages are no longer read. The
+// messages channel is closed when the stream ends.
+type streamer interface {
+	Stream(appID string) (msgs <-chan logMessage, close func(), err error)
+}
+
+// logMessage is a log message read from a stream. Timestamp is the
+// timestamp of its envelope, set when the log line was ingested by the
+// loggregator agent on the app's cell. It is zero if the envelope has none.
+type logMessage struct {
+	payload   string
+	timestamp time.Time
+}
+
+// envelopeTime converts an envelope timestamp in nanoseconds since the epoch
+// to a time.
+func envelopeTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// streamers returns the streamers that are configured, keyed by the name
+// used to select them with the stream query parameter:
+//
+//	v1      - the v1 firehose websocket (TARGET_URL)
+//	rlp     - the v2 RLP gRPC egress API (RLP_ADDR, RLP_CERT, RLP_KEY and
+//	          RLP_CA)
+//	gateway - the v2 RLP gateway (GATEWAY_URL)
+//
+// The v1 and gateway streams authenticate with tokens from tokens and
+// connect with tlsConfig.
+func streamers(location *url.URL, tokens tokenSource, tlsConfig *tls.Config) (map[string]streamer, error) {
+	s := map[string]streamer{
+		defaultStream: &v1Streamer{
+			location:  location,
+			tokens:    tokens,
+			tlsConfig: tlsConfig,
+		},
+	}
+
+	if addr := os.Getenv("RLP_ADDR"); addr != "" {
+		rlpTLSConfig, err := plumbing.NewClientMutualTLSConfig(
+			os.Getenv("RLP_CERT"),
+			os.Getenv("RLP_KEY"),
+			os.Getenv("RLP_CA"),
+			"reverselogproxy",
+		)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rlp tls config: %s", err)
+		}
+
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(rlpTLSConfig)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial rlp: %s", err)
+		}
+		s["rlp"] = &rlpStreamer{
+			client: loggregator_v2.NewEgressClient(conn),
+		}
+	}
+
+	if gatewayURL := os.Getenv("GATEWAY_URL"); gatewayURL != "" {
+		u, err := url.Parse(gatewayURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gateway url: %s", err)
+		}
+		s["gateway"] = &gatewayStreamer{
+			location: u,
+			tokens:   tokens,
+			client: &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: tlsConfig,
+				},
+			},
+		}
+	}
+
+	return s, nil
+}
+
+// v1Streamer streams log messages from the v1 websocket endpoint of the
+// traffic controller.
+type v1Streamer struct {
+	location  *url.URL
+	tokens    tokenSource
+	tlsConfig *tls.Config
+}
+
+func (s *v1Streamer) Stream(appID string) (<-chan logMessage, func(), error) {
+	token, err := s.tokens.Token()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get token: %s", err)
+	}
+
+	consumer := consumer.New(s.location.String(), s.tlsConfig, nil)
+	consumer.SetDebugPrinter(ConsoleDebugPrinter{})
+	consumer.RefreshTokenFrom(s.tokens)
+	envelopes, errorChan := consumer.Stream(appID, token)
+
+	go func() {
+		for err := range errorChan {
+			if err == nil {
+				return
+			}
+			log.Println(err)
+		}
+	}()
+
+	msgs := make(chan logMessage)
+	done := make(chan struct{})
+	go func() {
+		defer close(msgs)
+		for {
+			select {
+			case envelope, ok := <-envelopes:
+				if !ok {
+					return
+				}
+				if envelope.GetEventType() != events.Envelope_LogMessage {
+					continue
+				}
+
+				msg := logMessage{
+					payload:   string(envelope.GetLogMessage().GetMessage()),
+					timestamp: envelopeTime(envelope.GetTimestamp()),
+				}
+				select {
+				case msgs <- msg:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return msgs, func() {
+		close(done)
+		consumer.Close()
+	}, nil
+}
+
+// rlpStreamer streams log messages from the v2 egress API of the reverse
+// log proxy.
+type rlpStreamer struct {
+	client loggregator_v2.EgressClient
+}
+
+func (s *rlpStreamer) Stream(appID string) (<-chan logMessage, func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	receiver, err := s.client.BatchedReceiver(ctx, &loggregator_v2.EgressBatchRequest{
+		ShardId: shardID(),
+		Selectors: []*loggregator_v2.Selector{
+			{
+				SourceId: appID,
+				Message: &loggregator_v2.Selector_Log{
+					Log: &loggregator_v2.LogSelector{},
+				},
+			},
+		},
+	})
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	msgs := make(chan logMessage)
+	go func() {
+		defer close(msgs)
+		for {
+			batch, err := receiver.Recv()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("rlp stream failed: %s", err)
+				}
+				return
+			}
+
+			for _, e := range batch.GetBatch() {
+				if e.GetLog() == nil {
+					continue
+				}
+
+				msg := logMessage{
+					payload:   string(e.GetLog().GetPayload()),
+					timestamp: envelopeTime(e.GetTimestamp()),
+				}
+				select {
+				case msgs <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return msgs, cancel, nil
+}
+
+// gatewayStreamer streams log messages from the v2 RLP gateway. The gateway
+// writes batches of JSON encoded envelopes as server sent events.
+type gatewayStreamer struct {
+	location *url.URL
+	tokens   tokenSource
+	client   *http.Client
+}
+
+type gatewayBatch struct {
+	Batch []struct {
+		Timestamp gatewayInt64 `json:"timestamp"`
+		Log       *struct {
+			Payload []byte `json:"payload"`
+		} `json:"log"`
+	} `json:"batch"`
+}
+
+// gatewayInt64 decodes an int64 that the gateway encodes either as a JSON
+// string or a JSON number.
+type gatewayInt64 int64
+
+func (i *gatewayInt64) UnmarshalJSON(b []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(b), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = gatewayInt64(n)
+	return nil
+}
+
+func (s *gatewayStreamer) Stream(appID string) (<-chan logMessage, func(), error) {
+	u := *s.location
+	u.Path = "/v2/read"
+	u.RawQuery = url.Values{
+		"log":       {""},
+		"source_id": {appID},
+		"shard_id":  {shardID()},
+	}.Encode()
+
+	token, err := s.tokens.Token()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get token: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, nil, fmt.Errorf("unexpected status code from gateway: %d", resp.StatusCode)
+	}
+
+	msgs := make(chan logMessage)
+	go func() {
+		defer close(msgs)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+
+			var batch gatewayBatch
+			err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &batch)
+			if err != nil {
+				log.Printf("failed to decode gateway batch: %s", err)
+				continue
+			}
+
+			for _, e := range batch.Batch {
+				if e.Log == nil {
+					continue
+				}
+
+				msg := logMessage{
+					payload:   string(e.Log.Payload),
+					timestamp: envelopeTime(int64(e.Timestamp)),
+				}
+				select {
+				case msgs <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+
+		if err := scanner.Err(); err != nil && ctx.Err() == nil {
+			log.Printf("gateway stream failed: %s", err)
+		}
+	}()
+
+	return msgs, cancel, nil
+}
+
+func shardID() string {
+	return fmt.Sprint("loggregator-latency-", randomID())
+}
+
+func randomID() string {
+	id, _ := uuid.NewV4()
+	return id.String()
+}
@@ -0,0 +1,167 @@
+package linter
+
+import (
+	"go/ast"
+	"go/token"
+	"math"
+)
+
+// Call is a single frame in the chain of calls that leads from a function
+// holding a lock to a problem found in one of its callees.
+type Call struct {
+	Func string
+	token.Position
+}
+
+// callGraph resolves calls to the function declarations of a package. It
+// has no type information, so calls are resolved by name:
+//
+//   - foo() resolves to the function foo.
+//   - r.foo() resolves to the method foo on the same receiver type when r is
+//     the receiver of the calling method.
+//
+// Other method calls are not followed, as the type of their receiver is not
+// known and they could be calls on fields, imported packages or values of
+// other packages.
+type callGraph struct {
+	fset  *token.FileSet
+	funcs map[string]*ast.FuncDecl
+
+	// locked caches the problems found in a function when it is called with
+	// a lock held. inProgress maps the functions being checked to their
+	// depth in the chain of calls, and guards against recursive calls.
+	// shallowest is the depth of the shallowest in progress function that a
+	// recursive call reached. The problems of a function are only cached
+	// once no call from it reached a function above it, or they would miss
+	// the problems of the function still in progress.
+	locked     map[*ast.FuncDecl][]Problem
+	inProgress map[*ast.FuncDecl]int
+	shallowest int
+}
+
+func newCallGraph(funcs []*ast.FuncDecl, fset *token.FileSet) *callGraph {
+	g := &callGraph{
+		fset:       fset,
+		funcs:      make(map[string]*ast.FuncDecl),
+		locked:     make(map[*ast.FuncDecl][]Problem),
+		inProgress: make(map[*ast.FuncDecl]int),
+		shallowest: math.MaxInt32,
+	}
+	for _, fd := range funcs {
+		if fd.Body == nil {
+			continue
+		}
+		g.funcs[funcName(fd)] = fd
+	}
+	return g
+}
+
+// resolve returns the function declaration that the call invokes, or nil if
+// it is not declared in the package. caller is the function making the call.
+func (g *callGraph) resolve(call *ast.CallExpr, caller *ast.FuncDecl) *ast.FuncDecl {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return g.funcs[fun.Name]
+	case *ast.SelectorExpr:
+		x, ok := fun.X.(*ast.Ident)
+		if ok && caller != nil && x.Name == recvName(caller) {
+			return g.funcs[recvType(caller)+"."+fun.Sel.Name]
+		}
+	}
+	return nil
+}
+
+// lockedProblems returns the problems found in fd when it is entered with a
+// lock already held.
+func (g *callGraph) lockedProblems(fd *ast.FuncDecl) []Problem {
+	if problems, ok := g.locked[fd]; ok {
+		return problems
+	}
+	if depth, ok := g.inProgress[fd]; ok {
+		if depth < g.shallowest {
+			g.shallowest = depth
+		}
+		return nil
+	}
+	depth := len(g.inProgress)
+	g.inProgress[fd] = depth
+	defer delete(g.inProgress, fd)
+
+	outer := g.shallowest
+	g.shallowest = math.MaxInt32
+
+	lockAquired := true
+	p := &problemContainer{}
+	ast.Walk(context{
+		lockAquired:      &lockAquired,
+		problemContainer: p,
+		fset:             g.fset,
+		graph:            g,
+		fd:               fd,
+	}, fd)
+
+	if g.shallowest >= depth {
+		g.locked[fd] = p.problems
+		g.shallowest = outer
+	} else if outer < g.shallowest {
+		g.shallowest = outer
+	}
+	return p.problems
+}
+
+// calledWithLock returns the problems in the callee of call, each prefixed
+// with the call that leads to it.
+func (g *callGraph) calledWithLock(call *ast.CallExpr, caller *ast.FuncDecl) []Problem {
+	callee := g.resolve(call, caller)
+	if callee == nil {
+		return nil
+	}
+
+	frame := Call{
+		Func:     funcName(callee),
+		Position: g.fset.Position(call.Pos()),
+	}
+
+	var result []Problem
+	for _, p := range g.lockedProblems(callee) {
+		calls := make([]Call, 0, len(p.Calls)+1)
+		calls = append(calls, frame)
+		p.Calls = append(calls, p.Calls...)
+		result = append(result, p)
+	}
+	return result
+}
+
+// funcName returns the name of a function, qualified with the receiver type
+// for methods.
+func funcName(fd *ast.FuncDecl) string {
+	if fd.Recv == nil {
+		return fd.Name.Name
+	}
+	return recvType(fd) + "." + fd.Name.Name
+}
+
+func recvName(fd *ast.FuncDecl) string {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return ""
+	}
+	names := fd.Recv.List[0].Names
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0].Name
+}
+
+func recvType(fd *ast.FuncDecl) string {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return ""
+	}
+	t := fd.Recv.List[0].Type
+	if s, ok := t.(*ast.StarExpr); ok {
+		t = s.X
+	}
+	if i, ok := t.(*ast.Ident); ok {
+		return i.Name
+	}
+	return ""
+}
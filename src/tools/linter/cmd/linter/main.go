@@ -3,88 +3,151 @@ package main
 import (
 	"flag"
 	"fmt"
-	"go/build"
+	"go/ast"
 	"go/parser"
 	"go/token"
 	"log"
 	"os"
-	"path"
+	"sort"
 	"tools/linter"
+)
 
-	"github.com/kisielk/gotool"
+// Exit codes. Only problems at least as severe as -fail-on count as
+// findings.
+const (
+	exitClean    = 0
+	exitFindings = 1
+	exitError    = 2
 )
 
 var (
-	locksOnly   bool
-	searchPaths searchPath
+	locksOnly    bool
+	fix          bool
+	includeTests bool
+	configFile   string
+	failOn       string
+	searchPaths  stringList
+	excludes     stringList
 )
 
-type searchPath struct {
-	paths []string
+type stringList struct {
+	values []string
 }
 
-func (s *searchPath) String() string {
-	return fmt.Sprintf("%v", s.paths)
+func (s *stringList) String() string {
+	return fmt.Sprintf("%v", s.values)
 }
 
-func (s *searchPath) Set(val string) error {
-	s.paths = append(s.paths, val)
+func (s *stringList) Set(val string) error {
+	s.values = append(s.values, val)
 	return nil
 }
 
 func init() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage of %s: [flags] [patterns]\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 
-	flag.Var(&searchPaths, "path", "Required. The directory to search in, relative to the gopath. Multiple allowed. In form '___/___/ or ___/...'")
-	flag.BoolVar(&locksOnly, "locks-only", true, "Only output errors that include locks")
+	flag.Var(&searchPaths, "path", "The directory to search in, relative to the working directory or the gopath. Multiple allowed. In form '___/___/ or ___/...'. Patterns may also be given as arguments.")
+	flag.Var(&excludes, "exclude", "Glob of directories and files to skip, e.g. 'vendor' or '*.pb.go'. Multiple allowed.")
+	flag.BoolVar(&includeTests, "tests", false, "Include _test.go files")
+	flag.BoolVar(&locksOnly, "locks-only", false, "Only output errors that include locks, even if the config enables others")
+	flag.BoolVar(&fix, "fix", false, "Rewrite files with the suggested fixes")
+	flag.StringVar(&configFile, "config", "", "JSON file enabling, disabling and setting the severity of each problem kind. By default only problems that include locks are enabled")
+	flag.StringVar(&failOn, "fail-on", "warning", "The least severe problem that fails the run (info, warning or error)")
 }
 
 func main() {
-	var count int
+	var (
+		failed     bool
+		toolErrors int
+	)
 	flag.Parse()
-	if searchPaths.paths == nil {
+
+	patterns := append(searchPaths.values, flag.Args()...)
+	if len(patterns) == 0 {
 		flag.Usage()
-		os.Exit(1)
+		os.Exit(exitError)
 	}
-	importPaths := gotool.ImportPaths(searchPaths.paths)
-	d, err := os.Getwd()
+
+	threshold, err := linter.ParseSeverity(failOn)
 	if err != nil {
-		panic(err)
+		fatalf("invalid -fail-on: %s", err)
 	}
-	for _, fpath := range importPaths {
-		buildPkg, err := build.Import(fpath, d, 0)
+
+	config := linter.DefaultConfig()
+	if configFile != "" {
+		config, err = linter.LoadConfig(configFile)
 		if err != nil {
-			panic(err)
+			fatalf("failed to load config: %s", err)
 		}
+	}
+	if locksOnly {
+		config = config.LocksOnly()
+	}
 
+	dirs, errs := linter.PackageDirs(patterns, excludes.values)
+	for _, err := range errs {
+		log.Printf("failed to find packages: %s", err)
+		toolErrors++
+	}
+
+	filter := linter.NewFileFilter(includeTests, excludes.values)
+	for _, dir := range dirs {
 		fset := token.NewFileSet()
 
-		packages, err := parser.ParseDir(fset, buildPkg.Dir, linter.FileFilter, 0)
+		packages, err := parser.ParseDir(fset, dir, filter, 0)
 		if err != nil {
-			panic(err)
-		}
-		if _, ok := packages[buildPkg.Name]; !ok {
-			fmt.Printf("Skipping package: %s in path %s\n\n", buildPkg.Name, fpath)
+			log.Printf("failed to load %s: %s", dir, err)
+			toolErrors++
 			continue
 		}
 
-		astPkg := packages[buildPkg.Name]
+		var names []string
+		for name := range packages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			var funcs []*ast.FuncDecl
+			for _, f := range packages[name].Files {
+				funcs = append(funcs, linter.FuncDecls(f)...)
+			}
 
-		for fname, f := range astPkg.Files {
-			funcs := linter.FuncDecls(f)
-			problems := linter.CheckFuncs(funcs, fset, locksOnly)
-			count += len(problems)
+			problems := config.Apply(linter.CheckFuncs(funcs, fset, false))
 			for _, p := range problems {
-				srcPath := path.Join(buildPkg.Dir, path.Base(fname))
-				err := linter.PrintProblem(srcPath, p)
+				if p.Severity >= threshold {
+					failed = true
+				}
+
+				err := linter.PrintProblem(p.Filename, p)
 				if err != nil {
 					log.Println("error in getting source: ", err)
 				}
 			}
+
+			if fix {
+				err := linter.ApplyFixes(problems, fset)
+				if err != nil {
+					log.Printf("error in applying fixes: %s", err)
+					toolErrors++
+				}
+			}
 		}
 	}
-	os.Exit(count)
+
+	if toolErrors > 0 {
+		fatalf("failed on %d package(s)", toolErrors)
+	}
+	if failed {
+		os.Exit(exitFindings)
+	}
+	os.Exit(exitClean)
+}
+
+func fatalf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+	os.Exit(exitError)
 }
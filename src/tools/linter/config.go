@@ -0,0 +1,162 @@
+package linter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Kinds are all the kinds of problems CheckFuncs reports.
+var Kinds = []string{
+	"selectWithoutDefault",
+	"selectWithoutDefault-lock",
+	"sendChannel-withoutSelect",
+	"sendChannel-withoutSelect-lock",
+	"receiveChannel-withoutSelect",
+	"receiveChannel-withoutSelect-lock",
+}
+
+// Severity is how serious a problem is.
+type Severity int
+
+// The severities from least to most serious.
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+// ParseSeverity returns the Severity with the given name.
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "info":
+		return Info, nil
+	case "warning":
+		return Warning, nil
+	case "error":
+		return Error, nil
+	default:
+		return 0, fmt.Errorf("unknown severity: %q", s)
+	}
+}
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Severity) UnmarshalText(text []byte) error {
+	v, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
+}
+
+// Rule configures a kind of problem.
+type Rule struct {
+	Disabled bool     `json:"disabled"`
+	Severity Severity `json:"severity"`
+}
+
+// Config configures which problems are reported and how serious they are.
+type Config struct {
+	Rules map[string]Rule `json:"rules"`
+}
+
+// DefaultConfig enables the problems involving locks as errors. The rest are
+// warnings but disabled, and can be enabled by a config file.
+func DefaultConfig() Config {
+	c := Config{Rules: make(map[string]Rule)}
+	for _, k := range Kinds {
+		r := Rule{Severity: Warning, Disabled: true}
+		if strings.HasSuffix(k, "-lock") {
+			r = Rule{Severity: Error}
+		}
+		c.Rules[k] = r
+	}
+	return c
+}
+
+// LocksOnly returns a copy of the config with the problems that do not
+// involve locks disabled.
+func (c Config) LocksOnly() Config {
+	result := Config{Rules: make(map[string]Rule)}
+	for k, r := range c.Rules {
+		if !strings.HasSuffix(k, "-lock") {
+			r.Disabled = true
+		}
+		result.Rules[k] = r
+	}
+	return result
+}
+
+// LoadConfig reads a JSON config file. Rules in the file override those of
+// the DefaultConfig, e.g.:
+//
+//	{
+//	  "rules": {
+//	    "selectWithoutDefault-lock": {"disabled": true},
+//	    "sendChannel-withoutSelect": {"disabled": false, "severity": "info"}
+//	  }
+//	}
+func LoadConfig(path string) (Config, error) {
+	c := DefaultConfig()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var fc struct {
+		Rules map[string]struct {
+			Disabled *bool     `json:"disabled"`
+			Severity *Severity `json:"severity"`
+		} `json:"rules"`
+	}
+	err = json.Unmarshal(data, &fc)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid config %s: %s", path, err)
+	}
+
+	for k, fr := range fc.Rules {
+		r, ok := c.Rules[k]
+		if !ok {
+			return Config{}, fmt.Errorf("invalid config %s: unknown problem kind %q", path, k)
+		}
+		if fr.Disabled != nil {
+			r.Disabled = *fr.Disabled
+		}
+		if fr.Severity != nil {
+			r.Severity = *fr.Severity
+		}
+		c.Rules[k] = r
+	}
+	return c, nil
+}
+
+// Apply drops the problems whose rules are disabled and sets the severity
+// of the rest.
+func (c Config) Apply(problems []Problem) []Problem {
+	var result []Problem
+	for _, p := range problems {
+		r, ok := c.Rules[p.Kind]
+		if ok && r.Disabled {
+			continue
+		}
+		p.Severity = r.Severity
+		result = append(result, p)
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package linter_test
+
+import (
+	"io/ioutil"
+	"os"
+	"tools/linter"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	Context("DefaultConfig", func() {
+		It("reports lock problems as errors and disables the rest", func() {
+			c := linter.DefaultConfig()
+			Expect(c.Rules).To(HaveLen(len(linter.Kinds)))
+			Expect(c.Rules["sendChannel-withoutSelect-lock"]).To(Equal(linter.Rule{Severity: linter.Error}))
+			Expect(c.Rules["sendChannel-withoutSelect"]).To(Equal(linter.Rule{Disabled: true, Severity: linter.Warning}))
+		})
+	})
+
+	Context("LocksOnly", func() {
+		It("disables the problems that do not involve locks", func() {
+			c := linter.DefaultConfig()
+			c.Rules["sendChannel-withoutSelect"] = linter.Rule{Severity: linter.Info}
+
+			c = c.LocksOnly()
+			Expect(c.Rules["sendChannel-withoutSelect"]).To(Equal(linter.Rule{Disabled: true, Severity: linter.Info}))
+			Expect(c.Rules["sendChannel-withoutSelect-lock"]).To(Equal(linter.Rule{Severity: linter.Error}))
+		})
+	})
+
+	Context("LoadConfig", func() {
+		var path string
+
+		BeforeEach(func() {
+			f, err := ioutil.TempFile("", "linter-config")
+			Expect(err).ToNot(HaveOccurred())
+			path = f.Name()
+			f.Close()
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("overrides the default rules", func() {
+			writeConfig(path, `{
+				"rules": {
+					"selectWithoutDefault-lock": {"disabled": true},
+					"sendChannel-withoutSelect": {"disabled": false, "severity": "info"}
+				}
+			}`)
+
+			c, err := linter.LoadConfig(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Rules["selectWithoutDefault-lock"]).To(Equal(linter.Rule{Disabled: true, Severity: linter.Error}))
+			Expect(c.Rules["sendChannel-withoutSelect"]).To(Equal(linter.Rule{Severity: linter.Info}))
+			Expect(c.Rules["sendChannel-withoutSelect-lock"]).To(Equal(linter.Rule{Severity: linter.Error}))
+			Expect(c.Rules["selectWithoutDefault"]).To(Equal(linter.Rule{Disabled: true, Severity: linter.Warning}))
+		})
+
+		It("returns an error for unknown kinds", func() {
+			writeConfig(path, `{"rules": {"unknown": {}}}`)
+
+			_, err := linter.LoadConfig(path)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns an error for unknown severities", func() {
+			writeConfig(path, `{"rules": {"selectWithoutDefault": {"severity": "fatal"}}}`)
+
+			_, err := linter.LoadConfig(path)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Apply", func() {
+		It("drops disabled problems and sets the severity of the rest", func() {
+			c := linter.DefaultConfig()
+			c.Rules["selectWithoutDefault"] = linter.Rule{Disabled: true}
+
+			problems := c.Apply([]linter.Problem{
+				{Kind: "selectWithoutDefault"},
+				{Kind: "receiveChannel-withoutSelect-lock"},
+			})
+			Expect(problems).To(Equal([]linter.Problem{
+				{Kind: "receiveChannel-withoutSelect-lock", Severity: linter.Error},
+			}))
+		})
+	})
+
+	Context("ParseSeverity", func() {
+		It("parses each severity", func() {
+			for _, s := range []linter.Severity{linter.Info, linter.Warning, linter.Error} {
+				Expect(linter.ParseSeverity(s.String())).To(Equal(s))
+			}
+		})
+	})
+})
+
+func writeConfig(path, data string) {
+	err := ioutil.WriteFile(path, []byte(data), 0644)
+	Expect(err).ToNot(HaveOccurred())
+}
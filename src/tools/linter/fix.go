@@ -0,0 +1,169 @@
+package linter
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SuggestedFix is a change to the source code that resolves a Problem. It
+// mirrors analysis.SuggestedFix.
+type SuggestedFix struct {
+	Message   string
+	TextEdits []TextEdit
+}
+
+// TextEdit replaces the source code between Pos and End with NewText.
+type TextEdit struct {
+	Pos     token.Pos
+	End     token.Pos
+	NewText []byte
+}
+
+// sendFix wraps a bare channel send in a select. The select gives up on the
+// send when ctx is done, or right away when there is no context in scope.
+func sendFix(s *ast.SendStmt, ctxName string, fset *token.FileSet) []SuggestedFix {
+	var send bytes.Buffer
+	err := printer.Fprint(&send, fset, s)
+	if err != nil {
+		return nil
+	}
+
+	indent := strings.Repeat("\t", fset.Position(s.Pos()).Column-1)
+	escape, msg := "default:", "wrap send in select with default case"
+	if ctxName != "" {
+		escape = fmt.Sprintf("case <-%s.Done():", ctxName)
+		msg = fmt.Sprintf("wrap send in select with %s.Done() case", ctxName)
+	}
+
+	text := fmt.Sprintf("select {\n%scase %s:\n%s%s\n%s}", indent, send.String(), indent, escape, indent)
+	return []SuggestedFix{
+		{
+			Message: msg,
+			TextEdits: []TextEdit{
+				{
+					Pos:     s.Pos(),
+					End:     s.End(),
+					NewText: []byte(text),
+				},
+			},
+		},
+	}
+}
+
+// contextParam returns the name of the first context.Context parameter of a
+// function.
+func contextParam(ft *ast.FuncType) string {
+	if ft.Params == nil {
+		return ""
+	}
+	for _, f := range ft.Params.List {
+		if !isContextType(f.Type) {
+			continue
+		}
+		for _, n := range f.Names {
+			if n.Name != "_" {
+				return n.Name
+			}
+		}
+	}
+	return ""
+}
+
+// contextAssign returns the name of the variable a context is assigned to,
+// e.g. ctx in ctx, cancel := context.WithCancel(parent).
+func contextAssign(lhs, rhs []ast.Expr) string {
+	if len(lhs) == 0 || len(rhs) != 1 {
+		return ""
+	}
+	call, ok := rhs[0].(*ast.CallExpr)
+	if !ok || !isContextPkg(call.Fun) {
+		return ""
+	}
+	id, ok := lhs[0].(*ast.Ident)
+	if !ok || id.Name == "_" {
+		return ""
+	}
+	return id.Name
+}
+
+func isContextType(e ast.Expr) bool {
+	se, ok := e.(*ast.SelectorExpr)
+	return ok && isContextPkg(se) && se.Sel.Name == "Context"
+}
+
+func isContextPkg(e ast.Expr) bool {
+	se, ok := e.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x, ok := se.X.(*ast.Ident)
+	return ok && x.Name == "context"
+}
+
+// ApplyFixes rewrites the source files with the first suggested fix of each
+// problem. Edits that overlap an edit already applied are skipped.
+func ApplyFixes(problems []Problem, fset *token.FileSet) error {
+	edits := make(map[string][]TextEdit)
+	for _, p := range problems {
+		if len(p.SuggestedFixes) == 0 {
+			continue
+		}
+		for _, e := range p.SuggestedFixes[0].TextEdits {
+			filename := fset.Position(e.Pos).Filename
+			edits[filename] = append(edits[filename], e)
+		}
+	}
+
+	for filename, e := range edits {
+		err := applyEdits(filename, e, fset)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyEdits(filename string, edits []TextEdit, fset *token.FileSet) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	// Apply from the end of the file so earlier offsets stay valid.
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].Pos > edits[j].Pos
+	})
+
+	end := len(src)
+	for _, e := range edits {
+		start := fset.Position(e.Pos).Offset
+		stop := fset.Position(e.End).Offset
+		if stop > end {
+			continue
+		}
+		var buf []byte
+		buf = append(buf, src[:start]...)
+		buf = append(buf, e.NewText...)
+		buf = append(buf, src[stop:]...)
+		src = buf
+		end = start
+	}
+
+	formatted, err := format.Source(src)
+	if err != nil {
+		return fmt.Errorf("failed to format %s: %s", filename, err)
+	}
+	return ioutil.WriteFile(filename, formatted, info.Mode())
+}
@@ -0,0 +1,130 @@
+package linter_test
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"tools/linter"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ApplyFixes", func() {
+	var (
+		dir      string
+		filename string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "linter")
+		Expect(err).ToNot(HaveOccurred())
+		filename = filepath.Join(dir, "foo.go")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("rewrites the file with the suggested fixes", func() {
+		src := `package foo
+
+func BadSend(ctx context.Context) {
+	send <- true
+	send <- false
+}
+`
+		Expect(ioutil.WriteFile(filename, []byte(src), 0644)).To(Succeed())
+
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, filename, nil, 0)
+		Expect(err).ToNot(HaveOccurred())
+
+		problems := linter.CheckFuncs(linter.FuncDecls(f), fset, false)
+		Expect(linter.ApplyFixes(problems, fset)).To(Succeed())
+
+		fixed, err := ioutil.ReadFile(filename)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(fixed)).To(Equal(`package foo
+
+func BadSend(ctx context.Context) {
+	select {
+	case send <- true:
+	case <-ctx.Done():
+	}
+	select {
+	case send <- false:
+	case <-ctx.Done():
+	}
+}
+`))
+	})
+
+	It("fixes sends under a lock so that they pass the linter", func() {
+		src := `package foo
+
+func BadLockSend(ctx context.Context) {
+	mu.Lock()
+	defer mu.Unlock()
+	send <- true
+}
+`
+		Expect(ioutil.WriteFile(filename, []byte(src), 0644)).To(Succeed())
+
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, filename, nil, 0)
+		Expect(err).ToNot(HaveOccurred())
+
+		problems := linter.CheckFuncs(linter.FuncDecls(f), fset, false)
+		Expect(problems).To(HaveLen(1))
+		Expect(linter.ApplyFixes(problems, fset)).To(Succeed())
+
+		fset = token.NewFileSet()
+		f, err = parser.ParseFile(fset, filename, nil, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(linter.CheckFuncs(linter.FuncDecls(f), fset, false)).To(BeEmpty())
+	})
+
+	It("applies duplicate fixes once", func() {
+		src := `package foo
+
+func BadLock() {
+	mu.Lock()
+	helper()
+}
+
+func helper() {
+	send <- true
+}
+`
+		Expect(ioutil.WriteFile(filename, []byte(src), 0644)).To(Succeed())
+
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, filename, nil, 0)
+		Expect(err).ToNot(HaveOccurred())
+
+		problems := linter.CheckFuncs(linter.FuncDecls(f), fset, false)
+		Expect(problems).To(HaveLen(2))
+		Expect(linter.ApplyFixes(problems, fset)).To(Succeed())
+
+		fixed, err := ioutil.ReadFile(filename)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(fixed)).To(Equal(`package foo
+
+func BadLock() {
+	mu.Lock()
+	helper()
+}
+
+func helper() {
+	select {
+	case send <- true:
+	default:
+	}
+}
+`))
+	})
+})
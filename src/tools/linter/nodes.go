@@ -6,22 +6,33 @@ import (
 	"strings"
 )
 
-// Problem represents a problem found in the source code.
+// Problem represents a problem found in the source code. Calls is set when
+// the problem is in a function that was called with a lock held, and lists
+// the calls that lead to it, starting with the call made while holding the
+// lock. SuggestedFixes is set when there is a simple change that resolves
+// the problem. Severity is set by Config.Apply.
 type Problem struct {
 	Kind string
 	token.Position
+	Calls          []Call
+	SuggestedFixes []SuggestedFix
+	Severity       Severity
 }
 
 // CheckFuncs returns where there are problems given a set of potentially bad
-// function declarations.
+// function declarations. The funcs should be all the functions of a package
+// so that calls made while holding a lock can be followed into their callees.
 func CheckFuncs(funcs []*ast.FuncDecl, fset *token.FileSet, locksOnly bool) []Problem {
 	p := &problemContainer{}
+	g := newCallGraph(funcs, fset)
 	for _, fd := range funcs {
 		var lockAquired bool
 		c := context{
 			lockAquired:      &lockAquired,
 			problemContainer: p,
 			fset:             fset,
+			graph:            g,
+			fd:               fd,
 		}
 		ast.Walk(c, fd)
 	}
@@ -42,6 +53,15 @@ type context struct {
 	lockAquired *bool
 	inSelect    bool
 	fset        *token.FileSet
+	graph       *callGraph
+	fd          *ast.FuncDecl
+
+	// goCall is the call of the enclosing go statement. It runs in its own
+	// goroutine and so does not hold the caller's lock.
+	goCall *ast.CallExpr
+
+	// ctxName is the name of the context.Context in scope, if any.
+	ctxName *string
 	*problemContainer
 }
 
@@ -51,13 +71,55 @@ type problemContainer struct {
 
 func (c context) Visit(n ast.Node) ast.Visitor {
 	switch m := n.(type) {
+	case *ast.FuncDecl:
+		ctxName := contextParam(m.Type)
+		c.ctxName = &ctxName
+	case *ast.BlockStmt, *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt,
+		*ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.CaseClause, *ast.CommClause:
+		// A context declared in a block is out of scope once the block
+		// ends, so the block gets its own copy of the name.
+		ctxName := *c.ctxName
+		c.ctxName = &ctxName
+	case *ast.AssignStmt:
+		if name := contextAssign(m.Lhs, m.Rhs); name != "" {
+			*c.ctxName = name
+		}
+	case *ast.ValueSpec:
+		if len(m.Names) > 0 && isContextType(m.Type) && m.Names[0].Name != "_" {
+			*c.ctxName = m.Names[0].Name
+		}
+	case *ast.GoStmt:
+		c.goCall = m.Call
+	case *ast.FuncLit:
+		// Function literals have their own lock state and are not part of
+		// any enclosing select. They start with the lock state of where they
+		// are declared, unless they are started in their own goroutine.
+		lockAquired := *c.lockAquired
+		if c.goCall != nil && c.goCall.Fun == m {
+			lockAquired = false
+		}
+		ctxName := *c.ctxName
+		if name := contextParam(m.Type); name != "" {
+			ctxName = name
+		}
+		c.lockAquired = &lockAquired
+		c.ctxName = &ctxName
+		c.inSelect = false
+		c.goCall = nil
+		ast.Walk(c, m.Body)
+		return nil
 	case *ast.CallExpr:
 		if isLock(m) {
 			*c.lockAquired = true
+			break
+		}
+
+		if *c.lockAquired && m != c.goCall {
+			c.problems = append(c.problems, c.graph.calledWithLock(m, c.fd)...)
 		}
 	case *ast.SelectStmt:
 		c.inSelect = true
-		if !hasDefault(m) {
+		if !hasEscape(m, *c.ctxName) {
 			p := Problem{
 				Kind:     "selectWithoutDefault",
 				Position: c.fset.Position(m.Select),
@@ -73,8 +135,9 @@ func (c context) Visit(n ast.Node) ast.Visitor {
 	case *ast.SendStmt:
 		if !c.inSelect {
 			p := Problem{
-				Kind:     "sendChannel-withoutSelect",
-				Position: c.fset.Position(m.Pos()),
+				Kind:           "sendChannel-withoutSelect",
+				Position:       c.fset.Position(m.Pos()),
+				SuggestedFixes: sendFix(m, *c.ctxName, c.fset),
 			}
 
 			if *c.lockAquired {
@@ -114,19 +177,47 @@ func isLock(s *ast.CallExpr) bool {
 	return se.Sel.Name == "Lock"
 }
 
-func hasDefault(s *ast.SelectStmt) bool {
+// hasEscape returns whether a select has a default case, or a case that
+// receives from the Done channel of the context in scope, so that it cannot
+// block forever.
+func hasEscape(s *ast.SelectStmt, ctxName string) bool {
 	for _, c := range s.Body.List {
 		cc, ok := c.(*ast.CommClause)
 		if !ok {
 			continue
 		}
-		if cc.Comm == nil {
+		if cc.Comm == nil || isDone(cc.Comm, ctxName) {
 			return true
 		}
 	}
 	return false
 }
 
+// isDone returns whether a select case is a receive from ctxName.Done().
+func isDone(s ast.Stmt, ctxName string) bool {
+	if ctxName == "" {
+		return false
+	}
+	es, ok := s.(*ast.ExprStmt)
+	if !ok {
+		return false
+	}
+	u, ok := es.X.(*ast.UnaryExpr)
+	if !ok || u.Op != token.ARROW {
+		return false
+	}
+	call, ok := u.X.(*ast.CallExpr)
+	if !ok || len(call.Args) != 0 {
+		return false
+	}
+	se, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || se.Sel.Name != "Done" {
+		return false
+	}
+	x, ok := se.X.(*ast.Ident)
+	return ok && x.Name == ctxName
+}
+
 // FuncDecls returns all the function declarations in a file.
 func FuncDecls(f *ast.File) []*ast.FuncDecl {
 	result := make([]*ast.FuncDecl, 0)
@@ -47,6 +47,7 @@ var _ = Describe("nodes", func() {
 							Line:     5,
 							Column:   6,
 						},
+						SuggestedFixes: defaultFix(41, 53, "select {\n\t\t\t\t\tcase send <- true:\n\t\t\t\t\tdefault:\n\t\t\t\t\t}"),
 					},
 				))
 			})
@@ -109,6 +110,7 @@ var _ = Describe("nodes", func() {
 							Line:     7,
 							Column:   6,
 						},
+						SuggestedFixes: defaultFix(83, 94, "select {\n\t\t\t\t\tcase send <- foo:\n\t\t\t\t\tdefault:\n\t\t\t\t\t}"),
 					},
 				))
 			})
@@ -184,6 +186,452 @@ var _ = Describe("nodes", func() {
 			})
 		})
 
+		Context("across function calls", func() {
+			It("detects channel sends in funcs called with locks", func() {
+				src := `
+				func BadLockCall() {
+					mu.Lock()
+					defer mu.Unlock()
+					helper()
+				}
+
+				func helper() {
+					inner()
+				}
+
+				func inner() {
+					send <- true
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, true)).To(ConsistOf(
+					linter.Problem{
+						Kind: "sendChannel-withoutSelect-lock",
+						Position: token.Position{
+							Filename: "foo.go",
+							Offset:   162,
+							Line:     15,
+							Column:   6,
+						},
+						Calls: []linter.Call{
+							{
+								Func: "helper",
+								Position: token.Position{
+									Filename: "foo.go",
+									Offset:   82,
+									Line:     7,
+									Column:   6,
+								},
+							},
+							{
+								Func: "inner",
+								Position: token.Position{
+									Filename: "foo.go",
+									Offset:   123,
+									Line:     11,
+									Column:   6,
+								},
+							},
+						},
+						SuggestedFixes: defaultFix(163, 175, "select {\n\t\t\t\t\tcase send <- true:\n\t\t\t\t\tdefault:\n\t\t\t\t\t}"),
+					},
+				))
+			})
+
+			It("follows method calls on the same receiver", func() {
+				src := `
+				func (s *S) BadLockMethod() {
+					s.mu.Lock()
+					defer s.mu.Unlock()
+					s.wait()
+				}
+
+				func (s *S) wait() {
+					<-s.done
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, true)).To(ConsistOf(
+					linter.Problem{
+						Kind: "receiveChannel-withoutSelect-lock",
+						Position: token.Position{
+							Filename: "foo.go",
+							Offset:   141,
+							Line:     11,
+							Column:   6,
+						},
+						Calls: []linter.Call{
+							{
+								Func: "S.wait",
+								Position: token.Position{
+									Filename: "foo.go",
+									Offset:   95,
+									Line:     7,
+									Column:   6,
+								},
+							},
+						},
+					},
+				))
+			})
+
+			It("does not follow method calls on other values", func() {
+				src := `
+				func (s *S) GoodLockClose() {
+					s.mu.Lock()
+					defer s.mu.Unlock()
+					s.f.Close()
+					w.Close()
+					os.Close()
+				}
+
+				func (w *worker) Close() {
+					w.done <- true
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, true)).To(BeEmpty())
+			})
+
+			It("ignores funcs started in a goroutine", func() {
+				src := `
+				func GoodLockGo() {
+					mu.Lock()
+					defer mu.Unlock()
+					go helper()
+				}
+
+				func helper() {
+					send <- true
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, true)).To(BeEmpty())
+			})
+
+			It("handles recursive calls", func() {
+				src := `
+				func BadLockRecurse() {
+					mu.Lock()
+					defer mu.Unlock()
+					recurse()
+				}
+
+				func recurse() {
+					recurse()
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, true)).To(BeEmpty())
+			})
+
+			It("detects problems in mutually recursive funcs", func() {
+				src := `
+				func BadLockFirst() {
+					mu.Lock()
+					a()
+				}
+
+				func a() {
+					b()
+					send <- true
+				}
+
+				func b() {
+					a()
+				}
+
+				func BadLockSecond() {
+					mu.Lock()
+					b()
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, true)).To(ConsistOf(
+					linter.Problem{
+						Kind: "sendChannel-withoutSelect-lock",
+						Position: token.Position{
+							Filename: "foo.go",
+							Offset:   100,
+							Line:     11,
+							Column:   6,
+						},
+						Calls: []linter.Call{
+							{
+								Func: "a",
+								Position: token.Position{
+									Filename: "foo.go",
+									Offset:   60,
+									Line:     6,
+									Column:   6,
+								},
+							},
+						},
+						SuggestedFixes: defaultFix(101, 113, "select {\n\t\t\t\t\tcase send <- true:\n\t\t\t\t\tdefault:\n\t\t\t\t\t}"),
+					},
+					linter.Problem{
+						Kind: "sendChannel-withoutSelect-lock",
+						Position: token.Position{
+							Filename: "foo.go",
+							Offset:   100,
+							Line:     11,
+							Column:   6,
+						},
+						Calls: []linter.Call{
+							{
+								Func: "b",
+								Position: token.Position{
+									Filename: "foo.go",
+									Offset:   198,
+									Line:     20,
+									Column:   6,
+								},
+							},
+							{
+								Func: "a",
+								Position: token.Position{
+									Filename: "foo.go",
+									Offset:   140,
+									Line:     15,
+									Column:   6,
+								},
+							},
+						},
+						SuggestedFixes: defaultFix(101, 113, "select {\n\t\t\t\t\tcase send <- true:\n\t\t\t\t\tdefault:\n\t\t\t\t\t}"),
+					},
+				))
+			})
+		})
+
+		Context("with function literals", func() {
+			It("does not taint the enclosing func with locks in goroutines", func() {
+				src := `
+				func GoodLockInGo() {
+					go func() {
+						mu.Lock()
+						defer mu.Unlock()
+					}()
+					<-done
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, true)).To(BeEmpty())
+			})
+
+			It("does not taint the enclosing func with locks in deferred funcs", func() {
+				src := `
+				func GoodLockInDefer() {
+					defer func() {
+						mu.Lock()
+						defer mu.Unlock()
+					}()
+					<-done
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, true)).To(BeEmpty())
+			})
+
+			It("does not hold the enclosing lock in goroutines", func() {
+				src := `
+				func GoodGoWithLock() {
+					mu.Lock()
+					defer mu.Unlock()
+					go func() {
+						send <- true
+					}()
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, true)).To(BeEmpty())
+			})
+
+			It("holds the enclosing lock in funcs called in place", func() {
+				src := `
+				func BadLockLiteral() {
+					mu.Lock()
+					defer mu.Unlock()
+					func() {
+						send <- true
+					}()
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, true)).To(ConsistOf(
+					linter.Problem{
+						Kind: "sendChannel-withoutSelect-lock",
+						Position: token.Position{
+							Filename: "foo.go",
+							Offset:   100,
+							Line:     8,
+							Column:   7,
+						},
+						SuggestedFixes: defaultFix(101, 113, "select {\n\t\t\t\t\t\tcase send <- true:\n\t\t\t\t\t\tdefault:\n\t\t\t\t\t\t}"),
+					},
+				))
+			})
+
+			It("does not share the enclosing select", func() {
+				src := `
+				func BadSendInSelect() {
+					select {
+					case <-done:
+						go func() {
+							send <- true
+						}()
+					default:
+					}
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, false)).To(ConsistOf(
+					linter.Problem{
+						Kind: "sendChannel-withoutSelect",
+						Position: token.Position{
+							Filename: "foo.go",
+							Offset:   100,
+							Line:     8,
+							Column:   8,
+						},
+						SuggestedFixes: defaultFix(101, 113, "select {\n\t\t\t\t\t\t\tcase send <- true:\n\t\t\t\t\t\t\tdefault:\n\t\t\t\t\t\t\t}"),
+					},
+				))
+			})
+		})
+
+		Context("with a context in scope", func() {
+			It("suggests a select with the context's done channel", func() {
+				src := `
+				func BadSendWithContext(ctx context.Context) {
+					send <- true
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, false)).To(ConsistOf(
+					linter.Problem{
+						Kind: "sendChannel-withoutSelect",
+						Position: token.Position{
+							Filename: "foo.go",
+							Offset:   70,
+							Line:     5,
+							Column:   6,
+						},
+						SuggestedFixes: []linter.SuggestedFix{
+							{
+								Message: "wrap send in select with ctx.Done() case",
+								TextEdits: []linter.TextEdit{
+									{
+										Pos:     71,
+										End:     83,
+										NewText: []byte("select {\n\t\t\t\t\tcase send <- true:\n\t\t\t\t\tcase <-ctx.Done():\n\t\t\t\t\t}"),
+									},
+								},
+							},
+						},
+					},
+				))
+			})
+
+			It("uses contexts assigned in the func", func() {
+				src := `
+				func BadSendWithCancel() {
+					ctx, cancel := context.WithCancel(context.Background())
+					defer cancel()
+					send <- true
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, false)).To(ConsistOf(
+					linter.Problem{
+						Kind: "sendChannel-withoutSelect",
+						Position: token.Position{
+							Filename: "foo.go",
+							Offset:   131,
+							Line:     7,
+							Column:   6,
+						},
+						SuggestedFixes: []linter.SuggestedFix{
+							{
+								Message: "wrap send in select with ctx.Done() case",
+								TextEdits: []linter.TextEdit{
+									{
+										Pos:     132,
+										End:     144,
+										NewText: []byte("select {\n\t\t\t\t\tcase send <- true:\n\t\t\t\t\tcase <-ctx.Done():\n\t\t\t\t\t}"),
+									},
+								},
+							},
+						},
+					},
+				))
+			})
+
+			It("does not use contexts assigned in a block that has ended", func() {
+				src := `
+				func BadSendAfterBlock(x bool) {
+					if x {
+						ctx, cancel := context.WithCancel(context.Background())
+						defer cancel()
+						use(ctx)
+					}
+					send <- true
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, false)).To(ConsistOf(
+					linter.Problem{
+						Kind: "sendChannel-withoutSelect",
+						Position: token.Position{
+							Filename: "foo.go",
+							Offset:   173,
+							Line:     10,
+							Column:   6,
+						},
+						SuggestedFixes: defaultFix(174, 186, "select {\n\t\t\t\t\tcase send <- true:\n\t\t\t\t\tdefault:\n\t\t\t\t\t}"),
+					},
+				))
+			})
+
+			It("does not detect selects that give up when the context is done", func() {
+				src := `
+				func GoodLockSelect(ctx context.Context) {
+					mu.Lock()
+					defer mu.Unlock()
+					select {
+					case send <- foo:
+					case <-ctx.Done():
+					}
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, false)).To(BeEmpty())
+			})
+
+			It("detects selects on the done channel of a context that is not in scope", func() {
+				src := `
+				func BadLockSelect() {
+					mu.Lock()
+					defer mu.Unlock()
+					select {
+					case <-ctx.Done():
+					}
+				}
+			`
+				funcs, fset := parse(src)
+				Expect(linter.CheckFuncs(funcs, fset, false)).To(ConsistOf(
+					linter.Problem{
+						Kind: "selectWithoutDefault-lock",
+						Position: token.Position{
+							Filename: "foo.go",
+							Offset:   84,
+							Line:     7,
+							Column:   6,
+						},
+					},
+				))
+			})
+		})
+
 		Context("with locked only flag enabled", func() {
 			It("ignores funcs that doesn't have locks", func() {
 				src := `
@@ -221,6 +669,7 @@ var _ = Describe("nodes", func() {
 							Line:     7,
 							Column:   6,
 						},
+						SuggestedFixes: defaultFix(83, 94, "select {\n\t\t\t\t\tcase send <- foo:\n\t\t\t\t\tdefault:\n\t\t\t\t\t}"),
 					},
 				))
 			})
@@ -305,3 +754,14 @@ func parse(src string) ([]*ast.FuncDecl, *token.FileSet) {
 	Expect(err).To(Not(HaveOccurred()))
 	return linter.FuncDecls(f), fset
 }
+
+func defaultFix(pos, end token.Pos, text string) []linter.SuggestedFix {
+	return []linter.SuggestedFix{
+		{
+			Message: "wrap send in select with default case",
+			TextEdits: []linter.TextEdit{
+				{Pos: pos, End: end, NewText: []byte(text)},
+			},
+		},
+	}
+}
@@ -19,8 +19,14 @@ func PrintProblem(filename string, p Problem) error {
 	}
 	defer file.Close()
 
-	fmt.Fprintf(os.Stdout, "%s%s%s\n", red, p.Kind, reset)
+	fmt.Fprintf(os.Stdout, "%s%s: %s%s\n", red, p.Severity, p.Kind, reset)
 	fmt.Fprintf(os.Stdout, "%s:%d:%d\n", filename, p.Position.Line, p.Position.Column)
+	for _, c := range p.Calls {
+		fmt.Fprintf(os.Stdout, "  via %s at %s:%d:%d\n", c.Func, c.Filename, c.Line, c.Column)
+	}
+	for _, f := range p.SuggestedFixes {
+		fmt.Fprintf(os.Stdout, "  fix: %s\n", f.Message)
+	}
 
 	buf := bufio.NewScanner(file)
 	l := p.Position.Line
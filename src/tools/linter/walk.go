@@ -0,0 +1,146 @@
+package linter
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PackageDirs returns the directories matched by the given patterns. A
+// pattern is a directory, relative to the working directory or else to the
+// GOPATH, and may end in /... to include every directory beneath it.
+// When walking, directories whose path relative to the pattern matches any of
+// the exclude globs are skipped, as are testdata directories and directories
+// starting with . or _.
+//
+// A pattern that does not exist or a directory that can't be read does not
+// stop the walk. Its error is returned along with the directories found.
+func PackageDirs(patterns, excludes []string) ([]string, []error) {
+	seen := make(map[string]bool)
+	var (
+		dirs []string
+		errs []error
+	)
+	add := func(dir string) {
+		if seen[dir] {
+			return
+		}
+		seen[dir] = true
+		dirs = append(dirs, dir)
+	}
+
+	for _, pattern := range patterns {
+		root := strings.TrimSuffix(pattern, "...")
+		recursive := root != pattern
+		root = resolveDir(filepath.Clean(root))
+
+		info, err := os.Stat(root)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !info.IsDir() {
+			errs = append(errs, &os.PathError{Op: "walk", Path: root, Err: os.ErrInvalid})
+			continue
+		}
+
+		if !recursive {
+			add(root)
+			continue
+		}
+
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				errs = append(errs, err)
+				return nil
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			if path != root && skipDir(info.Name()) {
+				return filepath.SkipDir
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			if Excluded(rel, excludes) {
+				return filepath.SkipDir
+			}
+			if hasGoFiles(path) {
+				add(path)
+			}
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	sort.Strings(dirs)
+	return dirs, errs
+}
+
+// Excluded reports whether path matches any of the exclude globs. Each glob
+// is matched against the whole path and against each element of it, so
+// "vendor" excludes every vendor directory and "*.pb.go" every generated
+// protobuf file.
+func Excluded(path string, excludes []string) bool {
+	path = filepath.ToSlash(path)
+	elems := strings.Split(path, "/")
+	for _, glob := range excludes {
+		if ok, _ := filepath.Match(glob, path); ok {
+			return true
+		}
+		for _, e := range elems {
+			if ok, _ := filepath.Match(glob, e); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NewFileFilter returns a filter for parser.ParseDir that drops files
+// matching any of the exclude globs. Test files are dropped unless
+// includeTests is set.
+func NewFileFilter(includeTests bool, excludes []string) func(os.FileInfo) bool {
+	return func(f os.FileInfo) bool {
+		name := f.Name()
+		if !includeTests && strings.HasSuffix(name, "_test.go") {
+			return false
+		}
+		return !Excluded(name, excludes)
+	}
+}
+
+// resolveDir returns dir if it exists, otherwise dir within the GOPATH
+// src directories if it exists there.
+func resolveDir(dir string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return dir
+	}
+	for _, p := range filepath.SplitList(build.Default.GOPATH) {
+		d := filepath.Join(p, "src", dir)
+		if _, err := os.Stat(d); err == nil {
+			return d
+		}
+	}
+	return dir
+}
+
+func skipDir(name string) bool {
+	return name == "testdata" ||
+		strings.HasPrefix(name, ".") ||
+		strings.HasPrefix(name, "_")
+}
+
+func hasGoFiles(dir string) bool {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	return err == nil && len(matches) > 0
+}
@@ -0,0 +1,120 @@
+package linter_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"tools/linter"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Walk", func() {
+	Context("PackageDirs", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "linter")
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, d := range []string{
+				"a",
+				"a/b",
+				"a/vendor/c",
+				"a/testdata",
+				"a/.hidden",
+				"empty",
+			} {
+				Expect(os.MkdirAll(filepath.Join(dir, d), 0755)).To(Succeed())
+				if d == "empty" {
+					continue
+				}
+				writeFile(filepath.Join(dir, d, "foo.go"))
+			}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("returns every package beneath a pattern ending in ...", func() {
+			dirs, errs := linter.PackageDirs([]string{dir + "/..."}, nil)
+			Expect(errs).To(BeEmpty())
+			Expect(dirs).To(Equal([]string{
+				filepath.Join(dir, "a"),
+				filepath.Join(dir, "a/b"),
+				filepath.Join(dir, "a/vendor/c"),
+			}))
+		})
+
+		It("skips excluded directories", func() {
+			dirs, errs := linter.PackageDirs([]string{dir + "/..."}, []string{"vendor"})
+			Expect(errs).To(BeEmpty())
+			Expect(dirs).To(Equal([]string{
+				filepath.Join(dir, "a"),
+				filepath.Join(dir, "a/b"),
+			}))
+		})
+
+		It("returns only the directory without ...", func() {
+			dirs, errs := linter.PackageDirs([]string{filepath.Join(dir, "a")}, nil)
+			Expect(errs).To(BeEmpty())
+			Expect(dirs).To(Equal([]string{filepath.Join(dir, "a")}))
+		})
+
+		It("returns an error for a missing directory and carries on", func() {
+			dirs, errs := linter.PackageDirs([]string{
+				filepath.Join(dir, "missing/..."),
+				filepath.Join(dir, "a"),
+			}, nil)
+			Expect(errs).To(HaveLen(1))
+			Expect(dirs).To(Equal([]string{filepath.Join(dir, "a")}))
+		})
+
+		It("returns an error for a file", func() {
+			dirs, errs := linter.PackageDirs([]string{filepath.Join(dir, "a/foo.go")}, nil)
+			Expect(errs).To(HaveLen(1))
+			Expect(dirs).To(BeEmpty())
+		})
+	})
+
+	Context("Excluded", func() {
+		It("matches globs against each element of the path", func() {
+			Expect(linter.Excluded("a/vendor/b", []string{"vendor"})).To(BeTrue())
+			Expect(linter.Excluded("a/b/foo.pb.go", []string{"*.pb.go"})).To(BeTrue())
+			Expect(linter.Excluded("a/b/foo.go", []string{"*.pb.go"})).To(BeFalse())
+		})
+
+		It("matches globs against the whole path", func() {
+			Expect(linter.Excluded("a/b", []string{"a/b"})).To(BeTrue())
+			Expect(linter.Excluded("a/c", []string{"a/b"})).To(BeFalse())
+		})
+	})
+
+	Context("NewFileFilter", func() {
+		It("filters out test files by default", func() {
+			mock := newMockFileInfo()
+			mock.NameOutput.Ret0 <- "foo_test.go"
+			Expect(linter.NewFileFilter(false, nil)(mock)).To(BeFalse())
+		})
+
+		It("filters in test files when asked to", func() {
+			mock := newMockFileInfo()
+			mock.NameOutput.Ret0 <- "foo_test.go"
+			Expect(linter.NewFileFilter(true, nil)(mock)).To(BeTrue())
+		})
+
+		It("filters out excluded files", func() {
+			mock := newMockFileInfo()
+			mock.NameOutput.Ret0 <- "foo.pb.go"
+			Expect(linter.NewFileFilter(false, []string{"*.pb.go"})(mock)).To(BeFalse())
+		})
+	})
+})
+
+func writeFile(path string) {
+	err := ioutil.WriteFile(path, []byte("package foo\n"), 0644)
+	Expect(err).ToNot(HaveOccurred())
+}
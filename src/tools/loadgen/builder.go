@@ -0,0 +1,135 @@
+package loadgen
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+)
+
+// BuilderConfig configures the envelopes of a Builder.
+type BuilderConfig struct {
+	// Origin is the origin of the envelopes. It also names the counter and
+	// value metrics, e.g. <origin>.counter.
+	Origin string
+
+	// AppID is the app ID of log and container metric envelopes, and Index
+	// the instance index of container metrics.
+	AppID string
+	Index int
+
+	// Tags are added to every envelope. If SeqTag is set, each envelope is
+	// also tagged with its sequence number under that name.
+	Tags   map[string]string
+	SeqTag string
+
+	// Sizes are the payload sizes the envelopes cycle through, and Mix the
+	// types they are picked from.
+	Sizes []int
+	Mix   Mix
+}
+
+// Builder builds envelopes of the configured types and sizes. It is not safe
+// for concurrent use.
+type Builder struct {
+	config BuilderConfig
+
+	n       uint64
+	total   uint64
+	payload map[int][]byte
+}
+
+// NewBuilder returns a Builder for the config. The config needs at least one
+// size and one type.
+func NewBuilder(c BuilderConfig) *Builder {
+	payload := make(map[int][]byte)
+	for _, s := range c.Sizes {
+		payload[s] = []byte(strings.Repeat("x", s))
+	}
+	return &Builder{
+		config:  c,
+		payload: payload,
+	}
+}
+
+// Count returns how many envelopes have been built.
+func (b *Builder) Count() uint64 {
+	return b.n
+}
+
+// Next builds the next envelope. Sizes apply to the message of log envelopes
+// and the content length of HTTP envelopes.
+func (b *Builder) Next() *events.Envelope {
+	c := b.config
+	now := time.Now().UnixNano()
+	size := c.Sizes[b.n%uint64(len(c.Sizes))]
+	eventType := c.Mix.Pick(b.n)
+
+	env := &events.Envelope{
+		Origin:    proto.String(c.Origin),
+		Timestamp: proto.Int64(now),
+		EventType: eventType.Enum(),
+		Tags:      make(map[string]string, len(c.Tags)+1),
+	}
+	for k, v := range c.Tags {
+		env.Tags[k] = v
+	}
+	if c.SeqTag != "" {
+		env.Tags[c.SeqTag] = strconv.FormatUint(b.n, 10)
+	}
+	b.n++
+
+	switch eventType {
+	case events.Envelope_LogMessage:
+		env.LogMessage = &events.LogMessage{
+			Message:     b.payload[size],
+			MessageType: events.LogMessage_OUT.Enum(),
+			Timestamp:   proto.Int64(now),
+			AppId:       proto.String(c.AppID),
+		}
+	case events.Envelope_CounterEvent:
+		b.total++
+		env.CounterEvent = &events.CounterEvent{
+			Name:  proto.String(c.Origin + ".counter"),
+			Delta: proto.Uint64(1),
+			Total: proto.Uint64(b.total),
+		}
+	case events.Envelope_ValueMetric:
+		env.ValueMetric = &events.ValueMetric{
+			Name:  proto.String(c.Origin + ".value"),
+			Value: proto.Float64(rand.Float64() * 100),
+			Unit:  proto.String("ms"),
+		}
+	case events.Envelope_ContainerMetric:
+		env.ContainerMetric = &events.ContainerMetric{
+			ApplicationId:    proto.String(c.AppID),
+			InstanceIndex:    proto.Int32(int32(c.Index)),
+			CpuPercentage:    proto.Float64(rand.Float64() * 100),
+			MemoryBytes:      proto.Uint64(uint64(rand.Int63n(1 << 30))),
+			DiskBytes:        proto.Uint64(uint64(rand.Int63n(1 << 30))),
+			MemoryBytesQuota: proto.Uint64(1 << 30),
+			DiskBytesQuota:   proto.Uint64(1 << 30),
+		}
+	case events.Envelope_HttpStartStop:
+		env.HttpStartStop = &events.HttpStartStop{
+			StartTimestamp: proto.Int64(now - int64(time.Millisecond)),
+			StopTimestamp:  proto.Int64(now),
+			RequestId: &events.UUID{
+				Low:  proto.Uint64(uint64(rand.Int63())),
+				High: proto.Uint64(uint64(rand.Int63())),
+			},
+			PeerType:      events.PeerType_Server.Enum(),
+			Method:        events.Method_GET.Enum(),
+			Uri:           proto.String("http://" + c.Origin + ".example.com/"),
+			RemoteAddress: proto.String("127.0.0.1:8080"),
+			UserAgent:     proto.String(c.Origin),
+			StatusCode:    proto.Int32(200),
+			ContentLength: proto.Int64(int64(size)),
+		}
+	}
+
+	return env
+}
@@ -0,0 +1,69 @@
+package loadgen_test
+
+import (
+	"tools/loadgen"
+
+	"github.com/cloudfoundry/sonde-go/events"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Builder", func() {
+	var config loadgen.BuilderConfig
+
+	BeforeEach(func() {
+		m, err := loadgen.ParseMix("log,counter,container,http")
+		Expect(err).ToNot(HaveOccurred())
+		config = loadgen.BuilderConfig{
+			Origin: "test",
+			AppID:  "app",
+			Index:  3,
+			Sizes:  []int{4},
+			Mix:    m,
+		}
+	})
+
+	It("builds envelopes of the mix and sizes", func() {
+		b := loadgen.NewBuilder(config)
+
+		e := b.Next()
+		Expect(e.GetOrigin()).To(Equal("test"))
+		Expect(e.GetEventType()).To(Equal(events.Envelope_LogMessage))
+		Expect(e.GetLogMessage().GetAppId()).To(Equal("app"))
+		Expect(e.GetLogMessage().GetMessage()).To(HaveLen(4))
+
+		e = b.Next()
+		Expect(e.GetEventType()).To(Equal(events.Envelope_CounterEvent))
+		Expect(e.GetCounterEvent().GetName()).To(Equal("test.counter"))
+
+		e = b.Next()
+		Expect(e.GetEventType()).To(Equal(events.Envelope_ContainerMetric))
+		Expect(e.GetContainerMetric().GetApplicationId()).To(Equal("app"))
+		Expect(e.GetContainerMetric().GetInstanceIndex()).To(Equal(int32(3)))
+
+		e = b.Next()
+		Expect(e.GetEventType()).To(Equal(events.Envelope_HttpStartStop))
+		Expect(e.GetHttpStartStop().GetContentLength()).To(Equal(int64(4)))
+
+		Expect(b.Count()).To(Equal(uint64(4)))
+	})
+
+	It("tags each envelope with the tags and its sequence number", func() {
+		config.Tags = map[string]string{"writer_id": "w-1"}
+		config.SeqTag = "seq"
+		b := loadgen.NewBuilder(config)
+
+		Expect(b.Next().GetTags()).To(Equal(map[string]string{"writer_id": "w-1", "seq": "0"}))
+		Expect(b.Next().GetTags()).To(Equal(map[string]string{"writer_id": "w-1", "seq": "1"}))
+	})
+
+	It("does not share tags between envelopes", func() {
+		config.Tags = map[string]string{"writer_id": "w-1"}
+		b := loadgen.NewBuilder(config)
+
+		e := b.Next()
+		e.Tags["extra"] = "x"
+		Expect(b.Next().GetTags()).To(Equal(map[string]string{"writer_id": "w-1"}))
+	})
+})
@@ -0,0 +1,13 @@
+package loadgen_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestLoadgen(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Loadgen Suite")
+}
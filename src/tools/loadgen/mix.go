@@ -0,0 +1,85 @@
+// Package loadgen generates the v1 envelopes written by the load tools, and
+// paces them to a rate.
+package loadgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+// Types are the envelope types that can be generated, keyed by the name used
+// to select them. Counters become v2 counters and values and container
+// metrics v2 gauges once converted.
+var Types = map[string]events.Envelope_EventType{
+	"log":       events.Envelope_LogMessage,
+	"counter":   events.Envelope_CounterEvent,
+	"value":     events.Envelope_ValueMetric,
+	"container": events.Envelope_ContainerMetric,
+	"http":      events.Envelope_HttpStartStop,
+}
+
+// Mix is a weighted list of envelope types.
+type Mix struct {
+	types   []events.Envelope_EventType
+	weights []int
+	total   int
+}
+
+// ParseMix parses a comma separated list of envelope types, each with an
+// optional weight, e.g. "log:8,counter:1,value:1".
+func ParseMix(s string) (Mix, error) {
+	var m Mix
+	for _, t := range strings.Split(s, ",") {
+		name, weight := strings.TrimSpace(t), 1
+		if i := strings.Index(name, ":"); i >= 0 {
+			var err error
+			weight, err = strconv.Atoi(name[i+1:])
+			if err != nil || weight < 1 {
+				return Mix{}, fmt.Errorf("invalid weight for %q", name[:i])
+			}
+			name = name[:i]
+		}
+
+		eventType, ok := Types[name]
+		if !ok {
+			return Mix{}, fmt.Errorf("unknown envelope type %q", name)
+		}
+		m.types = append(m.types, eventType)
+		m.weights = append(m.weights, weight)
+		m.total += weight
+	}
+	return m, nil
+}
+
+// Pick returns the type of the n-th envelope. Every total envelopes each
+// type is picked as many times as its weight.
+func (m Mix) Pick(n uint64) events.Envelope_EventType {
+	i := int(n % uint64(m.total))
+	for j, w := range m.weights {
+		if i < w {
+			return m.types[j]
+		}
+		i -= w
+	}
+	return m.types[len(m.types)-1]
+}
+
+// ParseSizes parses a comma separated list of payload sizes in bytes, each
+// between 0 and max.
+func ParseSizes(s string, max int) ([]int, error) {
+	var result []int
+	for _, v := range strings.Split(s, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid size: %s", err)
+		}
+		if size < 0 || size > max {
+			return nil, fmt.Errorf("sizes must be between 0 and %d", max)
+		}
+		result = append(result, size)
+	}
+	return result, nil
+}
@@ -0,0 +1,58 @@
+package loadgen_test
+
+import (
+	"tools/loadgen"
+
+	"github.com/cloudfoundry/sonde-go/events"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mix", func() {
+	It("picks each type as many times as its weight", func() {
+		m, err := loadgen.ParseMix("log:2, counter")
+		Expect(err).ToNot(HaveOccurred())
+
+		var picked []events.Envelope_EventType
+		for n := uint64(0); n < 6; n++ {
+			picked = append(picked, m.Pick(n))
+		}
+		Expect(picked).To(Equal([]events.Envelope_EventType{
+			events.Envelope_LogMessage,
+			events.Envelope_LogMessage,
+			events.Envelope_CounterEvent,
+			events.Envelope_LogMessage,
+			events.Envelope_LogMessage,
+			events.Envelope_CounterEvent,
+		}))
+	})
+
+	DescribeTable("rejects invalid mixes", func(s string) {
+		_, err := loadgen.ParseMix(s)
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("unknown type", "gauge"),
+		Entry("empty type", "log,"),
+		Entry("zero weight", "log:0"),
+		Entry("invalid weight", "log:x"),
+	)
+})
+
+var _ = Describe("ParseSizes", func() {
+	It("parses a list of sizes", func() {
+		sizes, err := loadgen.ParseSizes("0, 10,100", 100)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sizes).To(Equal([]int{0, 10, 100}))
+	})
+
+	DescribeTable("rejects invalid sizes", func(s string) {
+		_, err := loadgen.ParseSizes(s, 100)
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("not a number", "x"),
+		Entry("negative", "-1"),
+		Entry("above the max", "101"),
+	)
+})
@@ -0,0 +1,159 @@
+package loadgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phase is a rate in envelopes per second held for a duration. A zero
+// duration holds the rate forever.
+type Phase struct {
+	Rate     float64
+	Duration time.Duration
+}
+
+// ParsePattern parses a comma separated list of rates in envelopes per
+// second, each held for a duration, e.g. "100:10s,1000:2s,0:5s". The pattern
+// repeats. A single rate without a duration is held forever.
+func ParsePattern(s string) ([]Phase, error) {
+	var phases []Phase
+	terms := strings.Split(s, ",")
+	for _, t := range terms {
+		t = strings.TrimSpace(t)
+		rate, d := t, ""
+		if i := strings.Index(t, ":"); i >= 0 {
+			rate, d = t[:i], t[i+1:]
+		}
+
+		var p Phase
+		var err error
+		p.Rate, err = strconv.ParseFloat(rate, 64)
+		if err != nil || p.Rate < 0 {
+			return nil, fmt.Errorf("invalid rate %q", rate)
+		}
+
+		if d == "" {
+			if len(terms) > 1 {
+				return nil, fmt.Errorf("rate %q needs a duration", t)
+			}
+			if p.Rate == 0 {
+				return nil, fmt.Errorf("rate must be greater than 0")
+			}
+			return []Phase{p}, nil
+		}
+		p.Duration, err = time.ParseDuration(d)
+		if err != nil || p.Duration <= 0 {
+			return nil, fmt.Errorf("invalid duration %q", d)
+		}
+		phases = append(phases, p)
+	}
+	return phases, nil
+}
+
+// Pacer is a token bucket that paces envelopes to a pattern of rates. Up to
+// burst envelopes can be sent at once after it has been idle. It is safe to
+// share between writers.
+type Pacer struct {
+	phases []Phase
+	period time.Duration
+	burst  float64
+	start  time.Time
+
+	mu     sync.Mutex
+	last   time.Time
+	tokens float64
+}
+
+// NewPacer returns a Pacer for phases as returned by ParsePattern.
+func NewPacer(phases []Phase, burst int) *Pacer {
+	if burst < 1 {
+		burst = 1
+	}
+
+	var period time.Duration
+	for _, p := range phases {
+		period += p.Duration
+	}
+
+	now := time.Now()
+	return &Pacer{
+		phases: phases,
+		period: period,
+		burst:  float64(burst),
+		start:  now,
+		last:   now,
+		tokens: float64(burst),
+	}
+}
+
+// Wait blocks until a token is available and takes it. It returns false
+// without waiting for the token if stop is closed first.
+func (p *Pacer) Wait(stop <-chan struct{}) bool {
+	for {
+		wait, ok := p.take(time.Now())
+		if ok {
+			return true
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// take takes a token if one is available, else it returns how long to wait
+// before trying again.
+func (p *Pacer) take(now time.Time) (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rate, end := p.phase(now)
+
+	// Tokens are accrued at the current rate, which is close enough across
+	// phase boundaries.
+	p.tokens += now.Sub(p.last).Seconds() * rate
+	if p.tokens > p.burst {
+		p.tokens = p.burst
+	}
+	p.last = now
+
+	if p.tokens >= 1 {
+		p.tokens--
+		return 0, true
+	}
+
+	var wait time.Duration
+	if rate > 0 {
+		wait = time.Duration((1 - p.tokens) / rate * float64(time.Second))
+	}
+	if !end.IsZero() && (rate == 0 || now.Add(wait).After(end)) {
+		wait = end.Sub(now)
+	}
+	return wait, false
+}
+
+// phase returns the rate at now and when it ends. A zero end means the rate
+// holds forever.
+func (p *Pacer) phase(now time.Time) (float64, time.Time) {
+	if p.period == 0 {
+		return p.phases[0].Rate, time.Time{}
+	}
+
+	elapsed := now.Sub(p.start) % p.period
+	periodStart := now.Add(-elapsed)
+	var end time.Duration
+	for _, ph := range p.phases {
+		end += ph.Duration
+		if elapsed < end {
+			return ph.Rate, periodStart.Add(end)
+		}
+	}
+	return p.phases[0].Rate, periodStart.Add(p.period)
+}
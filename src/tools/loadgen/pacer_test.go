@@ -0,0 +1,87 @@
+package loadgen_test
+
+import (
+	"time"
+	"tools/loadgen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParsePattern", func() {
+	It("parses a single rate", func() {
+		phases, err := loadgen.ParsePattern("100")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(phases).To(Equal([]loadgen.Phase{{Rate: 100}}))
+	})
+
+	It("parses a pattern of rates and durations", func() {
+		phases, err := loadgen.ParsePattern("100:10s, 0:2s")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(phases).To(Equal([]loadgen.Phase{
+			{Rate: 100, Duration: 10 * time.Second},
+			{Rate: 0, Duration: 2 * time.Second},
+		}))
+	})
+
+	DescribeTable("rejects invalid patterns", func(s string) {
+		_, err := loadgen.ParsePattern(s)
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("a zero rate held forever", "0"),
+		Entry("a negative rate", "-1:1s"),
+		Entry("a rate without a duration in a pattern", "100:1s,10"),
+		Entry("an invalid duration", "100:x"),
+		Entry("a zero duration", "100:0s"),
+	)
+})
+
+var _ = Describe("Pacer", func() {
+	It("allows a burst at once", func() {
+		p := loadgen.NewPacer([]loadgen.Phase{{Rate: 1}}, 3)
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			Expect(p.Wait(nil)).To(BeTrue())
+		}
+		Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+	})
+
+	It("paces to the rate", func() {
+		p := loadgen.NewPacer([]loadgen.Phase{{Rate: 100}}, 1)
+
+		start := time.Now()
+		for i := 0; i < 11; i++ {
+			Expect(p.Wait(nil)).To(BeTrue())
+		}
+		Expect(time.Since(start)).To(BeNumerically(">=", 90*time.Millisecond))
+	})
+
+	It("waits out a phase with a zero rate", func() {
+		p := loadgen.NewPacer([]loadgen.Phase{
+			{Rate: 0, Duration: 100 * time.Millisecond},
+			{Rate: 1000, Duration: time.Second},
+		}, 1)
+
+		start := time.Now()
+		Expect(p.Wait(nil)).To(BeTrue())
+		Expect(p.Wait(nil)).To(BeTrue())
+		Expect(time.Since(start)).To(BeNumerically(">=", 90*time.Millisecond))
+	})
+
+	It("returns false once stop is closed", func() {
+		p := loadgen.NewPacer([]loadgen.Phase{{Rate: 0.001}}, 1)
+		Expect(p.Wait(nil)).To(BeTrue())
+
+		stop := make(chan struct{})
+		done := make(chan bool)
+		go func() {
+			done <- p.Wait(stop)
+		}()
+
+		Consistently(done).ShouldNot(Receive())
+		close(stop)
+		Eventually(done).Should(Receive(BeFalse()))
+	})
+})
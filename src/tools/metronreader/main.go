@@ -1,9 +1,20 @@
-// metronreader: a tool for receiving messages from metron via the v1 gRPC
-// protocol.
-
-// Messages that have the origin "fast" will be aggregated and a rate will
-// print every second. Messages that have the origin "slow" will be printed
-// out immediately with their latency. All other messages will be thrown away.
+// metronreader: a tool for receiving messages from metron via the v1 and v2
+// gRPC protocols. Both are served on the same port.
+//
+// The trip times of the messages of each source, the origin of v1 envelopes
+// and the source ID of v2 envelopes, are aggregated into a histogram, and
+// optionally split by the connection they arrive on. Every interval a
+// summary of each source prints as a JSON line with the rate, the p50 and
+// p99 trip times and the number of messages that could not be read.
+// The rate of the "fast" source and the trip times of the "slow" source give
+// the fast and slow views of a load test.
+//
+// Messages tagged by udpwriter with a writer ID and sequence number are
+// counted per writer, and the received, lost, duplicated and reordered
+// counts of each writer print as JSON lines every interval.
+//
+// On SIGINT, a final summary of each source, including its histogram, and of
+// each writer prints before exiting.
 //
 package main
 
@@ -13,25 +24,34 @@ import (
 	"fmt"
 	"log"
 	"net"
-	"sync/atomic"
+	"os"
+	"os/signal"
 	"time"
 
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"code.cloudfoundry.org/loggregator/plumbing"
 
 	"github.com/cloudfoundry/sonde-go/events"
 	"github.com/gogo/protobuf/proto"
 
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 )
 
 var (
-	port     = flag.Int("port", 12345, "port to use to listen for gRPC v1 messages")
-	certFile = flag.String("cert", "", "cert to use to listen for gRPC v1 messages")
-	keyFile  = flag.String("key", "", "key to use to listen for gRPC v1 messages")
-	caFile   = flag.String("ca", "", "ca cert to use to listen for gRPC v1 messages")
+	port     = flag.Int("port", 12345, "port to use to listen for gRPC v1 and v2 messages")
+	certFile = flag.String("cert", "", "cert to use to listen for gRPC v1 and v2 messages")
+	keyFile  = flag.String("key", "", "key to use to listen for gRPC v1 and v2 messages")
+	caFile   = flag.String("ca", "", "ca cert to use to listen for gRPC v1 and v2 messages")
+	interval = flag.Duration("interval", 5*time.Second, "how often to print the summaries of each source and writer")
+
+	byConnection = flag.Bool("by-connection", false, "split the summaries of each source by the connection the messages arrive on")
 )
 
+// unknownSource is the source of the envelopes that could not be read.
+const unknownSource = "unknown"
+
 func main() {
 	flag.Parse()
 
@@ -45,29 +65,52 @@ func main() {
 	}
 	transportCreds := credentials.NewTLS(tlsConfig)
 
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	tracker := newLossTracker()
+	stats := newStatsRegistry(*byConnection)
+	go func() {
+		for range time.Tick(*interval) {
+			stats.Report(os.Stdout)
+			tracker.Report(os.Stdout, false)
+		}
+	}()
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		<-signals
+
+		stats.Final(os.Stdout)
+		tracker.Report(os.Stdout, true)
+		os.Exit(0)
+	}()
+
+	server := &Server{
+		tracker: tracker,
+		stats:   stats,
+	}
 	grpcServer := grpc.NewServer(grpc.Creds(transportCreds))
-	plumbing.RegisterDopplerIngestorServer(
-		grpcServer,
-		&Server{},
-	)
+	plumbing.RegisterDopplerIngestorServer(grpcServer, server)
+	loggregator_v2.RegisterIngressServer(grpcServer, server)
 	log.Printf("Starting gRPC server on %s", listener.Addr().String())
 	log.Fatal(grpcServer.Serve(listener))
 }
 
-type Server struct{}
+// Server receives v1 envelopes with Pusher and v2 envelopes with Sender,
+// BatchSender and Send. The envelopes sent with Send are all counted as one
+// connection.
+type Server struct {
+	tracker *lossTracker
+	stats   *statsRegistry
+}
 
 func (s *Server) Pusher(server plumbing.DopplerIngestor_PusherServer) error {
-	name := randString()
-
-	var fastRate uint64
-	stop := make(chan bool)
-	defer close(stop)
-	go printRate(&fastRate, name, stop)
+	conn := s.stats.Connection()
+	defer conn.Close()
 
 	for {
 		envData, err := server.Recv()
@@ -78,31 +121,71 @@ func (s *Server) Pusher(server plumbing.DopplerIngestor_PusherServer) error {
 		err = proto.Unmarshal(envData.Payload, &env)
 		if err != nil {
 			log.Print(err)
+			conn.Get(unknownSource).RecordError()
 			continue
 		}
-		tripTime := time.Since(time.Unix(0, *env.Timestamp))
-		if *env.Origin == "slow" {
-			fmt.Printf("%s: slow: %s\n", name, tripTime)
-		}
-		if *env.Origin == "fast" {
-			atomic.AddUint64(&fastRate, 1)
+		s.tracker.Track(env.GetTags())
+		conn.Get(env.GetOrigin()).Record(time.Since(time.Unix(0, env.GetTimestamp())))
+	}
+}
+
+func (s *Server) Sender(server loggregator_v2.Ingress_SenderServer) error {
+	conn := s.stats.Connection()
+	defer conn.Close()
+
+	for {
+		env, err := server.Recv()
+		if err != nil {
+			return nil
 		}
+		s.recordV2(conn.Get(env.GetSourceId()), env)
 	}
 }
 
-func printRate(fastRate *uint64, name string, stop chan bool) {
+func (s *Server) BatchSender(server loggregator_v2.Ingress_BatchSenderServer) error {
+	conn := s.stats.Connection()
+	defer conn.Close()
+
 	for {
-		select {
-		case <-stop:
-			return
-		default:
+		batch, err := server.Recv()
+		if err != nil {
+			return nil
+		}
+		for _, env := range batch.GetBatch() {
+			s.recordV2(conn.Get(env.GetSourceId()), env)
 		}
-		rate := atomic.SwapUint64(fastRate, 0)
-		fmt.Printf("%s: fast-rate: %d\\s\n", name, rate)
-		time.Sleep(time.Second)
 	}
 }
 
+func (s *Server) Send(_ context.Context, batch *loggregator_v2.EnvelopeBatch) (*loggregator_v2.SendResponse, error) {
+	for _, env := range batch.GetBatch() {
+		s.recordV2(s.stats.Get(env.GetSourceId(), "send"), env)
+	}
+	return &loggregator_v2.SendResponse{}, nil
+}
+
+func (s *Server) recordV2(stats *streamStats, env *loggregator_v2.Envelope) {
+	s.tracker.Track(v2Tags(env))
+	stats.Record(time.Since(time.Unix(0, env.GetTimestamp())))
+}
+
+// v2Tags returns the tags of a v2 envelope. Envelopes converted from v1 may
+// carry their tags as deprecated tags.
+func v2Tags(env *loggregator_v2.Envelope) map[string]string {
+	if len(env.GetDeprecatedTags()) == 0 {
+		return env.GetTags()
+	}
+
+	tags := make(map[string]string)
+	for k, v := range env.GetDeprecatedTags() {
+		tags[k] = v.GetText()
+	}
+	for k, v := range env.GetTags() {
+		tags[k] = v
+	}
+	return tags
+}
+
 func randString() string {
 	b := make([]byte, 3)
 	_, err := rand.Read(b)
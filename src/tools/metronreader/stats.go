@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// histogramBounds are the upper bounds of the trip time histogram buckets.
+// The last bucket counts everything above the largest bound.
+var histogramBounds = []time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// histogram counts trip times in the histogramBounds buckets.
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	errors  uint64
+	sum     time.Duration
+	max     time.Duration
+}
+
+func newHistogram() *histogram {
+	return &histogram{
+		buckets: make([]uint64, len(histogramBounds)+1),
+	}
+}
+
+func (h *histogram) record(d time.Duration) {
+	i := sort.Search(len(histogramBounds), func(i int) bool {
+		return d <= histogramBounds[i]
+	})
+	h.buckets[i]++
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+func (h *histogram) merge(o *histogram) {
+	for i, n := range o.buckets {
+		h.buckets[i] += n
+	}
+	h.count += o.count
+	h.errors += o.errors
+	h.sum += o.sum
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+// quantile returns the upper bound of the bucket that holds the q-th
+// quantile. Quantiles in the last bucket return the max.
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(h.count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+
+	var n uint64
+	for i, c := range h.buckets {
+		n += c
+		if n >= rank {
+			if i == len(histogramBounds) {
+				return h.max
+			}
+			return histogramBounds[i]
+		}
+	}
+	return h.max
+}
+
+// summary is a JSON line written for the envelopes of a source, the origin
+// of v1 envelopes or the source ID of v2 envelopes. Latencies are in
+// seconds.
+type summary struct {
+	Time       time.Time         `json:"time"`
+	Source     string            `json:"source"`
+	Connection string            `json:"connection,omitempty"`
+	Final      bool              `json:"final,omitempty"`
+	Seconds    float64           `json:"seconds"`
+	Count      uint64            `json:"count"`
+	Rate       float64           `json:"rate"`
+	Errors     uint64            `json:"errors"`
+	Mean       float64           `json:"mean"`
+	P50        float64           `json:"p50"`
+	P99        float64           `json:"p99"`
+	Max        float64           `json:"max"`
+	Histogram  []histogramBucket `json:"histogram,omitempty"`
+}
+
+// histogramBucket counts the trip times up to and including LE seconds that
+// are not in a lower bucket. The last bucket has an LE of +Inf, which is
+// encoded as null.
+type histogramBucket struct {
+	LE    *float64 `json:"le"`
+	Count uint64   `json:"count"`
+}
+
+func (h *histogram) summary(key statsKey, elapsed time.Duration, withHistogram bool) summary {
+	s := summary{
+		Time:       time.Now(),
+		Source:     key.Source,
+		Connection: key.Connection,
+		Seconds:    elapsed.Seconds(),
+		Count:      h.count,
+		Errors:     h.errors,
+		P50:        h.quantile(0.5).Seconds(),
+		P99:        h.quantile(0.99).Seconds(),
+		Max:        h.max.Seconds(),
+	}
+	if elapsed > 0 {
+		s.Rate = float64(h.count) / elapsed.Seconds()
+	}
+	if h.count > 0 {
+		s.Mean = (h.sum / time.Duration(h.count)).Seconds()
+	}
+
+	if withHistogram {
+		s.Histogram = make([]histogramBucket, len(h.buckets))
+		for i, n := range h.buckets {
+			if i < len(histogramBounds) {
+				le := histogramBounds[i].Seconds()
+				s.Histogram[i].LE = &le
+			}
+			s.Histogram[i].Count = n
+		}
+	}
+	return s
+}
+
+// statsKey identifies the stats of a source. Connection is only set when
+// the stats are split by connection.
+type statsKey struct {
+	Source     string
+	Connection string
+}
+
+// streamStats aggregates the trip times of the envelopes of a source over
+// the current interval and over the life of the stats.
+type streamStats struct {
+	key   statsKey
+	start time.Time
+
+	mu            sync.Mutex
+	intervalStart time.Time
+	interval      *histogram
+	total         *histogram
+}
+
+func newStreamStats(key statsKey) *streamStats {
+	now := time.Now()
+	return &streamStats{
+		key:           key,
+		start:         now,
+		intervalStart: now,
+		interval:      newHistogram(),
+		total:         newHistogram(),
+	}
+}
+
+// Record records the trip time of an envelope.
+func (s *streamStats) Record(d time.Duration) {
+	s.mu.Lock()
+	s.interval.record(d)
+	s.mu.Unlock()
+}
+
+// RecordError records an envelope that could not be read.
+func (s *streamStats) RecordError() {
+	s.mu.Lock()
+	s.interval.errors++
+	s.mu.Unlock()
+}
+
+// Flush returns the summary of the current interval and starts a new one.
+func (s *streamStats) Flush() summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	sum := s.interval.summary(s.key, now.Sub(s.intervalStart), false)
+	s.total.merge(s.interval)
+	s.interval = newHistogram()
+	s.intervalStart = now
+	return sum
+}
+
+// Total returns the summary over the life of the stats, including the
+// current interval.
+func (s *streamStats) Total() summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := newHistogram()
+	h.merge(s.total)
+	h.merge(s.interval)
+	sum := h.summary(s.key, time.Since(s.start), true)
+	sum.Final = true
+	return sum
+}
+
+// statsRegistry holds the stats of each source, split by connection if
+// byConnection is set. The stats of connections that have ended are kept so
+// they are part of the final summary.
+type statsRegistry struct {
+	byConnection bool
+
+	mu      sync.Mutex
+	stats   map[statsKey]*streamStats
+	streams []*streamStats
+	ended   map[*streamStats]bool
+}
+
+func newStatsRegistry(byConnection bool) *statsRegistry {
+	return &statsRegistry{
+		byConnection: byConnection,
+		stats:        make(map[statsKey]*streamStats),
+		ended:        make(map[*streamStats]bool),
+	}
+}
+
+// Get returns the stats of the source on the connection, registering them
+// on first use.
+func (r *statsRegistry) Get(source, conn string) *streamStats {
+	key := statsKey{Source: source}
+	if r.byConnection {
+		key.Connection = conn
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.stats[key]
+	if !ok {
+		s = newStreamStats(key)
+		r.stats[key] = s
+		r.streams = append(r.streams, s)
+	}
+	return s
+}
+
+// Close marks the stats of the connection as ended when the stats are split
+// by connection. They are no longer flushed.
+func (r *statsRegistry) Close(conn string) {
+	if !r.byConnection {
+		return
+	}
+
+	r.mu.Lock()
+	var closed []*streamStats
+	for key, s := range r.stats {
+		if key.Connection == conn {
+			delete(r.stats, key)
+			r.ended[s] = true
+			closed = append(closed, s)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, s := range closed {
+		s.Flush()
+	}
+}
+
+// connStats caches the stats a connection records to, so that only the
+// first envelope of each source takes the registry lock. It is not safe for
+// concurrent use.
+type connStats struct {
+	registry *statsRegistry
+	conn     string
+	stats    map[string]*streamStats
+}
+
+// Connection returns the stats of a new connection.
+func (r *statsRegistry) Connection() *connStats {
+	return &connStats{
+		registry: r,
+		conn:     randString(),
+		stats:    make(map[string]*streamStats),
+	}
+}
+
+// Get returns the stats of the source on the connection.
+func (c *connStats) Get(source string) *streamStats {
+	s, ok := c.stats[source]
+	if !ok {
+		s = c.registry.Get(source, c.conn)
+		c.stats[source] = s
+	}
+	return s
+}
+
+// Close marks the stats of the connection as ended.
+func (c *connStats) Close() {
+	c.registry.Close(c.conn)
+}
+
+// Report writes a JSON line summary of the current interval of each source
+// on each open connection.
+func (r *statsRegistry) Report(out io.Writer) {
+	r.mu.Lock()
+	var open []*streamStats
+	for _, s := range r.streams {
+		if !r.ended[s] {
+			open = append(open, s)
+		}
+	}
+	r.mu.Unlock()
+
+	enc := json.NewEncoder(out)
+	for _, s := range open {
+		enc.Encode(s.Flush())
+	}
+}
+
+// Final writes a JSON line summary over the life of the stats of each
+// source, and over all of them combined.
+func (r *statsRegistry) Final(out io.Writer) {
+	r.mu.Lock()
+	streams := make([]*streamStats, len(r.streams))
+	copy(streams, r.streams)
+	r.mu.Unlock()
+
+	var (
+		all   = newHistogram()
+		start = time.Now()
+		enc   = json.NewEncoder(out)
+	)
+	for _, s := range streams {
+		s.mu.Lock()
+		all.merge(s.total)
+		all.merge(s.interval)
+		if s.start.Before(start) {
+			start = s.start
+		}
+		s.mu.Unlock()
+
+		enc.Encode(s.Total())
+	}
+
+	sum := all.summary(statsKey{Source: "all"}, time.Since(start), true)
+	sum.Final = true
+	enc.Encode(sum)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// writerIDTag and seqTag are the tags udpwriter uses to tag each
+	// envelope with the ID of its writer and its sequence number.
+	writerIDTag = "writer_id"
+	seqTag      = "seq"
+
+	// reorderWindow is how many sequence numbers behind the highest one
+	// received a missing envelope can still arrive and count as reordered.
+	// Missing envelopes further behind count as lost for good, and if they
+	// still arrive they count as duplicated.
+	reorderWindow = 1 << 16
+)
+
+// lossTracker accounts for the envelopes of each writer from their sequence
+// numbers. It is safe for concurrent use by several streams.
+type lossTracker struct {
+	mu      sync.Mutex
+	writers map[string]*writerStats
+}
+
+// writerStats are the counts of the envelopes of one writer. The sequence
+// numbers before the first one received are not counted as lost, so the
+// reader can be started after the writer.
+type writerStats struct {
+	received   uint64
+	duplicated uint64
+	reordered  uint64
+	expired    uint64
+
+	max        uint64
+	nextExpire uint64
+	missing    map[uint64]struct{}
+}
+
+func newLossTracker() *lossTracker {
+	return &lossTracker{
+		writers: make(map[string]*writerStats),
+	}
+}
+
+// Track counts an envelope with the given tags. It returns false if the
+// envelope has no writer ID or sequence number.
+func (t *lossTracker) Track(tags map[string]string) bool {
+	writerID, ok := tags[writerIDTag]
+	if !ok {
+		return false
+	}
+	seq, err := strconv.ParseUint(tags[seqTag], 10, 64)
+	if err != nil {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w, ok := t.writers[writerID]
+	if !ok {
+		t.writers[writerID] = &writerStats{
+			received: 1,
+			max:      seq,
+			missing:  make(map[uint64]struct{}),
+		}
+		return true
+	}
+	w.track(seq)
+	return true
+}
+
+func (w *writerStats) track(seq uint64) {
+	switch {
+	case seq > w.max:
+		gap := seq - w.max - 1
+		if gap > reorderWindow {
+			w.expired += gap - reorderWindow
+			gap = reorderWindow
+		}
+		for s := seq - gap; s < seq; s++ {
+			w.missing[s] = struct{}{}
+		}
+		w.max = seq
+		w.received++
+		if w.max >= w.nextExpire {
+			w.expire()
+			w.nextExpire = w.max + reorderWindow/16
+		}
+	default:
+		if _, ok := w.missing[seq]; ok {
+			delete(w.missing, seq)
+			w.received++
+			w.reordered++
+			return
+		}
+		w.duplicated++
+	}
+}
+
+// expire counts the missing envelopes that fell out of the reorder window
+// as lost for good.
+func (w *writerStats) expire() {
+	if w.max < reorderWindow || len(w.missing) == 0 {
+		return
+	}
+	for s := range w.missing {
+		if s < w.max-reorderWindow {
+			delete(w.missing, s)
+			w.expired++
+		}
+	}
+}
+
+// lost returns the number of envelopes that have not been received.
+func (w *writerStats) lost() uint64 {
+	return w.expired + uint64(len(w.missing))
+}
+
+// writerSummary is a JSON line written for a writer.
+type writerSummary struct {
+	Time       time.Time `json:"time"`
+	Writer     string    `json:"writer"`
+	Final      bool      `json:"final,omitempty"`
+	Received   uint64    `json:"received"`
+	Lost       uint64    `json:"lost"`
+	Duplicated uint64    `json:"duplicated"`
+	Reordered  uint64    `json:"reordered"`
+}
+
+// Report writes a JSON line with the counts of each writer, sorted by writer
+// ID.
+func (t *lossTracker) Report(out io.Writer, final bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := make([]string, 0, len(t.writers))
+	for id := range t.writers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	enc := json.NewEncoder(out)
+	for _, id := range ids {
+		w := t.writers[id]
+		enc.Encode(writerSummary{
+			Time:       time.Now(),
+			Writer:     id,
+			Final:      final,
+			Received:   w.received,
+			Lost:       w.lost(),
+			Duplicated: w.duplicated,
+			Reordered:  w.reordered,
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Package reconnect keeps a stream open across errors, reconnecting with
+// exponential backoff, and counts the gaps in the stream.
+package reconnect
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Backoff is an exponential backoff that starts at Min and doubles on each
+// attempt up to Max.
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+
+	attempts uint
+}
+
+// Next returns how long to wait before the next attempt.
+func (b *Backoff) Next() time.Duration {
+	d := b.Min << b.attempts
+	if d > b.Max || d <= 0 {
+		return b.Max
+	}
+	b.attempts++
+	return d
+}
+
+// Reset starts the backoff over from Min.
+func (b *Backoff) Reset() {
+	b.attempts = 0
+}
+
+// Stats counts the reconnects and the gaps in a stream. A gap is the time
+// from a stream failing to data being read again.
+type Stats struct {
+	Reconnects uint64
+	Gaps       uint64
+	GapTime    time.Duration
+}
+
+// Run calls read until ctx is done. read opens a stream and reads from it
+// until it fails, calling connected whenever it reads data. After read
+// returns, Run waits for the backoff and calls it again.
+func Run(ctx context.Context, b Backoff, read func(ctx context.Context, connected func()) error) Stats {
+	var (
+		s    Stats
+		down time.Time
+	)
+	endGap := func() {
+		if down.IsZero() {
+			return
+		}
+		s.Gaps++
+		s.GapTime += time.Since(down)
+		down = time.Time{}
+	}
+	connected := func() {
+		endGap()
+		b.Reset()
+	}
+
+	for {
+		err := read(ctx, connected)
+		if ctx.Err() != nil {
+			endGap()
+			return s
+		}
+
+		if down.IsZero() {
+			down = time.Now()
+		}
+		wait := b.Next()
+		log.Printf("stream failed, reconnecting in %s: %s", wait, err)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			endGap()
+			return s
+		}
+		s.Reconnects++
+	}
+}
@@ -0,0 +1,13 @@
+package reconnect_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestReconnect(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Reconnect Suite")
+}
@@ -0,0 +1,91 @@
+package reconnect_test
+
+import (
+	"context"
+	"errors"
+	"time"
+	"tools/reconnect"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backoff", func() {
+	It("doubles up to the max", func() {
+		b := reconnect.Backoff{Min: time.Second, Max: 5 * time.Second}
+		Expect(b.Next()).To(Equal(time.Second))
+		Expect(b.Next()).To(Equal(2 * time.Second))
+		Expect(b.Next()).To(Equal(4 * time.Second))
+		Expect(b.Next()).To(Equal(5 * time.Second))
+		Expect(b.Next()).To(Equal(5 * time.Second))
+	})
+
+	It("starts over from the min after a reset", func() {
+		b := reconnect.Backoff{Min: time.Second, Max: 5 * time.Second}
+		b.Next()
+		b.Next()
+		b.Reset()
+		Expect(b.Next()).To(Equal(time.Second))
+	})
+})
+
+var _ = Describe("Run", func() {
+	var b reconnect.Backoff
+
+	BeforeEach(func() {
+		b = reconnect.Backoff{Min: time.Millisecond, Max: time.Millisecond}
+	})
+
+	It("reconnects until the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		var calls int
+		stats := reconnect.Run(ctx, b, func(ctx context.Context, connected func()) error {
+			calls++
+			if calls == 3 {
+				cancel()
+			}
+			return errors.New("stream failed")
+		})
+
+		Expect(calls).To(Equal(3))
+		Expect(stats.Reconnects).To(Equal(uint64(2)))
+	})
+
+	It("counts a gap from a failure until data is read again", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		var calls int
+		stats := reconnect.Run(ctx, b, func(ctx context.Context, connected func()) error {
+			calls++
+			switch calls {
+			case 1:
+				connected()
+			case 2:
+			case 3:
+				time.Sleep(10 * time.Millisecond)
+				connected()
+			case 4:
+				connected()
+				cancel()
+			}
+			return errors.New("stream failed")
+		})
+
+		Expect(stats.Reconnects).To(Equal(uint64(3)))
+		Expect(stats.Gaps).To(Equal(uint64(2)))
+		Expect(stats.GapTime).To(BeNumerically(">=", 10*time.Millisecond))
+	})
+
+	It("counts an open gap when the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		var calls int
+		stats := reconnect.Run(ctx, b, func(ctx context.Context, connected func()) error {
+			calls++
+			if calls == 2 {
+				cancel()
+			}
+			return errors.New("stream failed")
+		})
+
+		Expect(stats.Gaps).To(Equal(uint64(1)))
+	})
+})
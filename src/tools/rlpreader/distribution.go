@@ -0,0 +1,138 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// dedupWindow is how many envelopes of a shard are remembered to detect
+// duplicates. Up to twice as many are remembered while the window rotates.
+const dedupWindow = 1 << 16
+
+// distribution tracks how the envelopes of each shard are distributed across
+// its streams.
+type distribution struct {
+	mu     sync.Mutex
+	shards map[string]*shardDistribution
+}
+
+type shardDistribution struct {
+	streams    []uint64
+	duplicates uint64
+
+	// seen and prev map the encoded envelopes to the stream that read them
+	// first.
+	seen map[string]int
+	prev map[string]int
+}
+
+func newDistribution() *distribution {
+	return &distribution{
+		shards: make(map[string]*shardDistribution),
+	}
+}
+
+// Add adds a stream to the shard and returns its index.
+func (d *distribution) Add(shardID string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.shards[shardID]
+	if !ok {
+		s = &shardDistribution{seen: make(map[string]int)}
+		d.shards[shardID] = s
+	}
+	s.streams = append(s.streams, 0)
+	return len(s.streams) - 1
+}
+
+// Record records an envelope read by a stream of the shard. An envelope that
+// was already read by another stream of the shard counts as a duplicate.
+func (d *distribution) Record(shardID string, stream int, e *loggregator_v2.Envelope) {
+	key, err := dedupKey(e)
+	if err != nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s := d.shards[shardID]
+	s.streams[stream]++
+
+	first, ok := s.seen[key]
+	if !ok {
+		first, ok = s.prev[key]
+	}
+	if ok {
+		if first != stream {
+			s.duplicates++
+		}
+		return
+	}
+
+	if len(s.seen) >= dedupWindow {
+		s.prev, s.seen = s.seen, make(map[string]int)
+	}
+	s.seen[key] = stream
+}
+
+// dedupKey returns the deterministic encoding of the envelope. The default
+// encoding orders map entries, such as tags, at random and so would not match
+// the same envelope read by another stream.
+func dedupKey(e *loggregator_v2.Envelope) (string, error) {
+	var b proto.Buffer
+	b.SetDeterministic(true)
+	err := b.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return string(b.Bytes()), nil
+}
+
+// shardReport is the JSON line written for each shard. Envelopes counts each
+// envelope once, however many streams read it.
+type shardReport struct {
+	ShardID    string    `json:"shard_id"`
+	Envelopes  uint64    `json:"envelopes"`
+	Duplicates uint64    `json:"duplicates"`
+	Streams    []uint64  `json:"streams"`
+	Share      []float64 `json:"share"`
+}
+
+// Report returns the distribution of each shard, ordered by shard ID.
+func (d *distribution) Report() []shardReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var reports []shardReport
+	for id, s := range d.shards {
+		r := shardReport{
+			ShardID:    id,
+			Duplicates: s.duplicates,
+			Streams:    append([]uint64(nil), s.streams...),
+			Share:      make([]float64, len(s.streams)),
+		}
+
+		var total uint64
+		for _, n := range s.streams {
+			total += n
+		}
+		r.Envelopes = total - s.duplicates
+		if total > 0 {
+			for i, n := range s.streams {
+				r.Share[i] = float64(n) / float64(total)
+			}
+		}
+		reports = append(reports, r)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].ShardID < reports[j].ShardID
+	})
+	return reports
+}
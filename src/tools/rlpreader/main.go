@@ -1,14 +1,48 @@
 // rlpreader: a tool that reads messages from RLP.
 //
+// Envelopes are selected with the selector syntax of the tools/selector
+// package, e.g. -select log,app-guid/gauge:cpu+memory.
+//
+// Envelopes are written to stdout in one of the output formats:
+//
+//	compact - one line of timestamp, source, type and message (default)
+//	json    - JSON lines
+//	proto   - the protobuf binary encoding, each prefixed with its length as
+//	          a varint
+//	text    - Go struct dumps
+//
+// Envelopes can be filtered on tags and on a regular expression matched
+// against their message.
+//
+// In stats mode, instead of the envelopes, a JSON line of statistics prints
+// every interval: the rate of envelopes by type and source ID, batch sizes,
+// bytes and the delay from the envelope timestamps.
+//
+// The stream is reopened with backoff whenever it fails. Reading stops after
+// the duration, the count of envelopes or on SIGINT, and a summary of the
+// envelopes read, reconnects and gaps prints to stderr.
+//
+// To check the fan-out of a shard, several streams can be opened with the
+// same shard ID, and for several shard IDs. A JSON line for each shard then
+// prints to stderr at the end with how many envelopes each of its streams
+// read, and how many were duplicates already read by another of its streams.
+// Envelopes are counted after filtering.
+//
 package main
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc"
@@ -16,11 +50,16 @@ import (
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"code.cloudfoundry.org/loggregator/plumbing"
+
+	"tools/reconnect"
+	"tools/selector"
 )
 
 var (
 	target            = flag.String("target", "localhost:8082", "the host:port of the target rlp")
-	appID             = flag.String("app-id", "", "app-id to stream data")
+	appID             = flag.String("app-id", "", "app-id to stream data (same as -source-id)")
+	sourceIDs         = flag.String("source-id", "", "comma separated source IDs of the selectors that do not have one")
+	selectSpec        = flag.String("select", "log", "comma separated selectors of the form [source-id/]type[:args], see the selector package")
 	shardID           = flag.String("shard-id", "", "sets the shard_id field")
 	deterministicName = flag.String("deterministic-name", "", "sets the deterministic_name field")
 	certFile          = flag.String("cert", "", "cert to use to connect to rlp")
@@ -28,15 +67,46 @@ var (
 	caFile            = flag.String("ca", "", "ca cert to use to connect to rlp")
 	delay             = flag.Duration("delay", 0, "delay inbetween reading messages")
 	preferredTags     = flag.Bool("preferred-tags", false, "use preferred tags")
-	counterName       = flag.String("counter", "", "select a counter with the given name")
-	gaugeNames        = flag.String("gauge", "", "select a gauge with the given comma separated names (must contain all the names)")
+	counterName       = flag.String("counter", "", "select a counter with the given name (same as -select counter:name)")
+	gaugeNames        = flag.String("gauge", "", "select a gauge with the given comma separated names (must contain all the names, same as -select gauge:name1+name2)")
 
 	metricNames = flag.Bool("metric-names", false, "this is really only useful while trying out deterministic routing. It only grabs counters and gauges and only prints their names")
+
+	output = flag.String("output", "compact", "output format: compact, json, proto or text")
+	match  = flag.String("match", "", "only print envelopes whose message matches the regular expression")
+	tags   = tagFlags{}
+
+	statsMode = flag.Bool("stats", false, "print statistics every interval instead of the envelopes")
+	interval  = flag.Duration("interval", 5*time.Second, "how often to print statistics in stats mode")
+
+	duration   = flag.Duration("duration", 0, "how long to read for, 0 is until SIGINT")
+	count      = flag.Uint64("count", 0, "stop after reading this many envelopes, 0 is no limit")
+	maxBackoff = flag.Duration("max-backoff", 10*time.Second, "the longest to wait before reconnecting")
+
+	streams = flag.Int("streams", 1, "the number of concurrent streams to open for each shard ID")
+	shards  = flag.Int("shards", 1, "the number of shard IDs to open streams for")
 )
 
+// minBackoff is how long to wait before the first reconnect.
+const minBackoff = 100 * time.Millisecond
+
 func main() {
+	flag.Var(tags, "tag", "only print envelopes with the tag key=value (can be repeated)")
 	flag.Parse()
 
+	format, ok := formatters[*output]
+	if !ok {
+		log.Fatalf("unknown output format: %q", *output)
+	}
+	f := filter{tags: tags}
+	if *match != "" {
+		var err error
+		f.match, err = regexp.Compile(*match)
+		if err != nil {
+			log.Fatalf("invalid match: %s", err)
+		}
+	}
+
 	tlsConfig, err := plumbing.NewClientMutualTLSConfig(
 		*certFile,
 		*keyFile,
@@ -54,91 +124,269 @@ func main() {
 	}
 	client := loggregator_v2.NewEgressClient(conn)
 
-	var selectors []*loggregator_v2.Selector
-	if *counterName != "" {
-		selectors = append(selectors, &loggregator_v2.Selector{
-			SourceId: *appID,
-			Message: &loggregator_v2.Selector_Counter{
-				Counter: &loggregator_v2.CounterSelector{
-					Name: *counterName,
-				},
-			},
-		})
+	selectors, err := buildSelectors()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if *gaugeNames != "" {
-		selectors = append(selectors, &loggregator_v2.Selector{
-			SourceId: *appID,
-			Message: &loggregator_v2.Selector_Gauge{
-				Gauge: &loggregator_v2.GaugeSelector{
-					Names: strings.Split(*gaugeNames, ","),
+	ctx, cancel := runContext()
+	defer cancel()
+
+	var stats *streamStats
+	if *statsMode {
+		stats = newStreamStats()
+		go func() {
+			enc := json.NewEncoder(os.Stdout)
+			for range time.Tick(*interval) {
+				enc.Encode(stats.Flush())
+			}
+		}()
+	}
+
+	out := &sink{w: bufio.NewWriter(os.Stdout)}
+	dist := newDistribution()
+
+	var readers []*reader
+	for _, id := range buildShardIDs(*shardID, *shards) {
+		for i := 0; i < *streams; i++ {
+			readers = append(readers, &reader{
+				client: client,
+				req: &loggregator_v2.EgressBatchRequest{
+					ShardId:           id,
+					DeterministicName: *deterministicName,
+					UsePreferredTags:  *preferredTags,
+					Selectors:         selectors,
 				},
-			},
-		})
+				stream: dist.Add(id),
+				dist:   dist,
+				filter: f,
+				format: format,
+				stats:  stats,
+				out:    out,
+				cancel: cancel,
+			})
+		}
 	}
 
-	if len(selectors) == 0 {
-		selectors = append(selectors, &loggregator_v2.Selector{
-			SourceId: *appID,
-			Message: &loggregator_v2.Selector_Log{
-				Log: &loggregator_v2.LogSelector{},
-			},
-		})
+	start := time.Now()
+	var wg sync.WaitGroup
+	rs := make([]reconnect.Stats, len(readers))
+	for i, r := range readers {
+		wg.Add(1)
+		go func(i int, r *reader) {
+			defer wg.Done()
+			rs[i] = reconnect.Run(ctx, reconnect.Backoff{Min: minBackoff, Max: *maxBackoff}, r.read)
+		}(i, r)
 	}
+	wg.Wait()
 
-	if *metricNames {
-		selectors = []*loggregator_v2.Selector{
-			{
-				Message: &loggregator_v2.Selector_Counter{
-					Counter: &loggregator_v2.CounterSelector{},
-				},
-			},
-			{
-				Message: &loggregator_v2.Selector_Gauge{
-					Gauge: &loggregator_v2.GaugeSelector{},
-				},
-			},
+	out.w.Flush()
+	if stats != nil {
+		json.NewEncoder(os.Stdout).Encode(stats.Flush())
+	}
+
+	var batches uint64
+	var total reconnect.Stats
+	for i, r := range readers {
+		batches += r.batches
+		total.Reconnects += rs[i].Reconnects
+		total.Gaps += rs[i].Gaps
+		total.GapTime += rs[i].GapTime
+	}
+	log.Printf(
+		"read %d envelopes in %d batches over %s, reconnects: %d, gaps: %d (%s)",
+		out.envelopes, batches, time.Since(start), total.Reconnects, total.Gaps, total.GapTime,
+	)
+
+	if len(readers) > 1 {
+		enc := json.NewEncoder(os.Stderr)
+		for _, r := range dist.Report() {
+			enc.Encode(r)
 		}
 	}
+}
 
-	receiver, err := client.BatchedReceiver(context.TODO(), &loggregator_v2.EgressBatchRequest{
-		ShardId:           buildShardID(*shardID),
-		DeterministicName: *deterministicName,
-		UsePreferredTags:  *preferredTags,
-		Selectors:         selectors,
-	})
+// runContext returns a context that is done on SIGINT or once the duration
+// has passed.
+func runContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if *duration > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), *duration)
+	}
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+
+	return ctx, cancel
+}
+
+// sink is the stdout shared by all the streams.
+type sink struct {
+	mu        sync.Mutex
+	w         *bufio.Writer
+	envelopes uint64
+}
+
+// reader reads the envelopes of a stream and prints them, or records them in
+// stats mode.
+type reader struct {
+	client loggregator_v2.EgressClient
+	req    *loggregator_v2.EgressBatchRequest
+	stream int
+	dist   *distribution
+	filter filter
+	format formatter
+	stats  *streamStats
+	out    *sink
+	cancel func()
+
+	batches uint64
+}
+
+// read opens a stream and reads from it until it fails, or until count
+// envelopes have been read across all the streams.
+func (r *reader) read(ctx context.Context, connected func()) error {
+	receiver, err := r.client.BatchedReceiver(ctx, r.req)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	for {
 		batch, err := receiver.Recv()
 		if err != nil {
-			log.Printf("stopping reader, got err: %s", err)
-			return
+			return err
 		}
-		for _, e := range batch.Batch {
-			if *metricNames {
-				if e.GetCounter() != nil {
-					fmt.Printf("%s\n", e.GetCounter().GetName())
-					continue
-				}
-
-				var names []string
-				for name := range e.GetGauge().GetMetrics() {
-					names = append(names, name)
-				}
-
-				fmt.Printf("%s\n", strings.Join(names, ", "))
-				continue
-			}
+		connected()
 
-			fmt.Printf("%+v\n", e)
+		r.batches++
+		if r.stats != nil {
+			r.stats.RecordBatch(len(batch.Batch))
+		}
+		if !r.writeBatch(batch.Batch) {
+			r.cancel()
+			return ctx.Err()
 		}
 		time.Sleep(*delay)
 	}
 }
 
+// writeBatch writes the envelopes of a batch that match the filter. It
+// returns false once count envelopes have been written.
+func (r *reader) writeBatch(batch []*loggregator_v2.Envelope) bool {
+	r.out.mu.Lock()
+	defer r.out.mu.Unlock()
+
+	now := time.Now()
+	for _, e := range batch {
+		if !r.filter.matches(e) {
+			continue
+		}
+
+		// Other readers may have reached the count while this one waited
+		// for the lock.
+		if r.done() {
+			break
+		}
+
+		r.dist.Record(r.req.ShardId, r.stream, e)
+		r.out.envelopes++
+		r.write(e, now)
+	}
+
+	err := r.out.w.Flush()
+	if err != nil {
+		log.Fatalf("failed to write envelopes: %s", err)
+	}
+	return !r.done()
+}
+
+// done returns whether -count envelopes have been written. The caller holds
+// out.mu.
+func (r *reader) done() bool {
+	return *count > 0 && r.out.envelopes >= *count
+}
+
+func (r *reader) write(e *loggregator_v2.Envelope, now time.Time) {
+	if r.stats != nil {
+		r.stats.Record(e, now)
+		return
+	}
+
+	if *metricNames {
+		if e.GetCounter() != nil {
+			fmt.Fprintf(r.out.w, "%s\n", e.GetCounter().GetName())
+			return
+		}
+
+		var names []string
+		for name := range e.GetGauge().GetMetrics() {
+			names = append(names, name)
+		}
+
+		fmt.Fprintf(r.out.w, "%s\n", strings.Join(names, ", "))
+		return
+	}
+
+	err := r.format(r.out.w, e)
+	if err != nil {
+		log.Fatalf("failed to write envelope: %s", err)
+	}
+}
+
+// buildSelectors builds the selectors from the select flag, or from the
+// counter, gauge and metric-names flags if they are set.
+func buildSelectors() ([]*loggregator_v2.Selector, error) {
+	if *metricNames {
+		return selector.Parse("counter,gauge", nil)
+	}
+
+	spec := *selectSpec
+	var legacy []string
+	if *counterName != "" {
+		legacy = append(legacy, "counter:"+*counterName)
+	}
+	if *gaugeNames != "" {
+		legacy = append(legacy, "gauge:"+strings.Replace(*gaugeNames, ",", "+", -1))
+	}
+	if len(legacy) > 0 {
+		spec = strings.Join(legacy, ",")
+	}
+
+	var ids []string
+	if *appID != "" {
+		ids = append(ids, *appID)
+	}
+	if *sourceIDs != "" {
+		for _, id := range strings.Split(*sourceIDs, ",") {
+			ids = append(ids, strings.TrimSpace(id))
+		}
+	}
+	return selector.Parse(spec, ids)
+}
+
+// buildShardIDs returns n shard IDs. A single shard uses the shard ID as is,
+// several append their index to it.
+func buildShardIDs(shardID string, n int) []string {
+	id := buildShardID(shardID)
+	if n <= 1 {
+		return []string{id}
+	}
+
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%s-%d", id, i)
+	}
+	return ids
+}
+
 func buildShardID(shardID string) string {
 	if shardID == "" {
 		return "rlp-reader-" + randString()
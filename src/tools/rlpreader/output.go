@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// formatter writes an envelope to w.
+type formatter func(w io.Writer, e *loggregator_v2.Envelope) error
+
+// formatters are the output formats, keyed by the name used to select them
+// with the output flag.
+var formatters = map[string]formatter{
+	"compact": writeCompact,
+	"json":    writeJSON,
+	"proto":   writeDelimited,
+	"text":    writeText,
+}
+
+// writeCompact writes an envelope as one human readable line of its
+// timestamp, source, type and message.
+func writeCompact(w io.Writer, e *loggregator_v2.Envelope) error {
+	source := e.GetSourceId()
+	if e.GetInstanceId() != "" {
+		source += "/" + e.GetInstanceId()
+	}
+
+	_, err := fmt.Fprintf(w, "%s %s %s %s\n",
+		time.Unix(0, e.GetTimestamp()).UTC().Format(time.RFC3339Nano),
+		source,
+		envelopeType(e),
+		message(e),
+	)
+	return err
+}
+
+// writeJSON writes an envelope as one line of JSON.
+func writeJSON(w io.Writer, e *loggregator_v2.Envelope) error {
+	m := jsonpb.Marshaler{}
+	err := m.Marshal(w, e)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// writeDelimited writes an envelope in the protobuf binary encoding, prefixed
+// with its length as a varint.
+func writeDelimited(w io.Writer, e *loggregator_v2.Envelope) error {
+	b, err := proto.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(proto.EncodeVarint(uint64(len(b))), b...))
+	return err
+}
+
+// writeText writes an envelope as a Go struct.
+func writeText(w io.Writer, e *loggregator_v2.Envelope) error {
+	_, err := fmt.Fprintf(w, "%+v\n", e)
+	return err
+}
+
+func envelopeType(e *loggregator_v2.Envelope) string {
+	switch e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		return "LOG"
+	case *loggregator_v2.Envelope_Counter:
+		return "COUNTER"
+	case *loggregator_v2.Envelope_Gauge:
+		return "GAUGE"
+	case *loggregator_v2.Envelope_Timer:
+		return "TIMER"
+	case *loggregator_v2.Envelope_Event:
+		return "EVENT"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// message returns the message of an envelope as text. This is also what the
+// match filter matches against.
+func message(e *loggregator_v2.Envelope) string {
+	switch m := e.GetMessage().(type) {
+	case *loggregator_v2.Envelope_Log:
+		return strings.TrimRight(string(m.Log.GetPayload()), "\n")
+	case *loggregator_v2.Envelope_Counter:
+		return fmt.Sprintf("%s delta=%d total=%d", m.Counter.GetName(), m.Counter.GetDelta(), m.Counter.GetTotal())
+	case *loggregator_v2.Envelope_Gauge:
+		var metrics []string
+		for name, v := range m.Gauge.GetMetrics() {
+			metrics = append(metrics, fmt.Sprintf("%s=%g%s", name, v.GetValue(), v.GetUnit()))
+		}
+		sort.Strings(metrics)
+		return strings.Join(metrics, " ")
+	case *loggregator_v2.Envelope_Timer:
+		return fmt.Sprintf("%s %s", m.Timer.GetName(), time.Duration(m.Timer.GetStop()-m.Timer.GetStart()))
+	case *loggregator_v2.Envelope_Event:
+		return fmt.Sprintf("%s: %s", m.Event.GetTitle(), m.Event.GetBody())
+	default:
+		return ""
+	}
+}
+
+// filter drops the envelopes that do not have all the tags or whose message
+// does not match.
+type filter struct {
+	tags  map[string]string
+	match *regexp.Regexp
+}
+
+func (f filter) matches(e *loggregator_v2.Envelope) bool {
+	for k, v := range f.tags {
+		if tag(e, k) != v {
+			return false
+		}
+	}
+	if f.match != nil && !f.match.MatchString(message(e)) {
+		return false
+	}
+	return true
+}
+
+// tag returns the value of a tag, looking at the deprecated tags if it is
+// not set.
+func tag(e *loggregator_v2.Envelope, k string) string {
+	if v, ok := e.GetTags()[k]; ok {
+		return v
+	}
+	return e.GetDeprecatedTags()[k].GetText()
+}
+
+// tagFlags is a flag that can be repeated to set key=value tags.
+type tagFlags map[string]string
+
+func (t tagFlags) String() string {
+	var s []string
+	for k, v := range t {
+		s = append(s, k+"="+v)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func (t tagFlags) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i < 1 {
+		return fmt.Errorf("tag must be of the form key=value: %q", s)
+	}
+	t[s[:i]] = s[i+1:]
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// streamStats aggregates the batches and envelopes read over an interval.
+type streamStats struct {
+	mu             sync.Mutex
+	start          time.Time
+	batches        uint64
+	batchEnvelopes uint64
+	maxBatch       int
+	envelopes      uint64
+	bytes          uint64
+	byType         map[string]uint64
+	bySource       map[string]uint64
+	delays         []time.Duration
+}
+
+func newStreamStats() *streamStats {
+	s := &streamStats{}
+	s.reset(time.Now())
+	return s
+}
+
+func (s *streamStats) reset(now time.Time) {
+	s.start = now
+	s.batches = 0
+	s.batchEnvelopes = 0
+	s.maxBatch = 0
+	s.envelopes = 0
+	s.bytes = 0
+	s.byType = make(map[string]uint64)
+	s.bySource = make(map[string]uint64)
+	s.delays = nil
+}
+
+// RecordBatch records a batch of size envelopes. Batch sizes include the
+// envelopes that are filtered out.
+func (s *streamStats) RecordBatch(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches++
+	s.batchEnvelopes += uint64(size)
+	if size > s.maxBatch {
+		s.maxBatch = size
+	}
+}
+
+// Record records an envelope that was read at now. The delay is the time
+// since the envelope's timestamp.
+func (s *streamStats) Record(e *loggregator_v2.Envelope, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.envelopes++
+	s.bytes += uint64(proto.Size(e))
+	s.byType[envelopeType(e)]++
+	s.bySource[e.GetSourceId()]++
+	s.delays = append(s.delays, now.Sub(time.Unix(0, e.GetTimestamp())))
+}
+
+// statsSummary is the JSON line written for an interval. Rates are per
+// second and delays in seconds.
+type statsSummary struct {
+	Time          time.Time          `json:"time"`
+	Seconds       float64            `json:"seconds"`
+	Envelopes     uint64             `json:"envelopes"`
+	Rate          float64            `json:"rate"`
+	Batches       uint64             `json:"batches"`
+	MeanBatchSize float64            `json:"mean_batch_size"`
+	MaxBatchSize  int                `json:"max_batch_size"`
+	Bytes         uint64             `json:"bytes"`
+	ByteRate      float64            `json:"byte_rate"`
+	RateByType    map[string]float64 `json:"rate_by_type"`
+	RateBySource  map[string]float64 `json:"rate_by_source_id"`
+	Delay         delaySummary       `json:"delay"`
+}
+
+type delaySummary struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// Flush returns the summary of the current interval and starts a new one.
+func (s *streamStats) Flush() statsSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(s.start).Seconds()
+	rate := func(n uint64) float64 {
+		if elapsed <= 0 {
+			return 0
+		}
+		return float64(n) / elapsed
+	}
+
+	sum := statsSummary{
+		Time:         now,
+		Seconds:      elapsed,
+		Envelopes:    s.envelopes,
+		Rate:         rate(s.envelopes),
+		Batches:      s.batches,
+		MaxBatchSize: s.maxBatch,
+		Bytes:        s.bytes,
+		ByteRate:     rate(s.bytes),
+		RateByType:   make(map[string]float64),
+		RateBySource: make(map[string]float64),
+		Delay:        summarizeDelays(s.delays),
+	}
+	if s.batches > 0 {
+		sum.MeanBatchSize = float64(s.batchEnvelopes) / float64(s.batches)
+	}
+	for t, n := range s.byType {
+		sum.RateByType[t] = rate(n)
+	}
+	for id, n := range s.bySource {
+		sum.RateBySource[id] = rate(n)
+	}
+
+	s.reset(now)
+	return sum
+}
+
+func summarizeDelays(delays []time.Duration) delaySummary {
+	if len(delays) == 0 {
+		return delaySummary{}
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+
+	var total time.Duration
+	for _, d := range delays {
+		total += d
+	}
+	return delaySummary{
+		Mean: (total / time.Duration(len(delays))).Seconds(),
+		P50:  percentile(delays, 50).Seconds(),
+		P99:  percentile(delays, 99).Seconds(),
+		Max:  delays[len(delays)-1].Seconds(),
+	}
+}
+
+// percentile returns the nearest-rank percentile p of the sorted delays.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
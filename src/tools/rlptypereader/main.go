@@ -1,5 +1,9 @@
 // rlpreader: a tool that reads messages from RLP.
 //
+// The stream is reopened with backoff whenever it fails. Reading stops after
+// the duration, the count of envelopes or on SIGINT, and a summary of the
+// envelopes read, reconnects and gaps prints to stderr.
+//
 package main
 
 import (
@@ -7,13 +11,19 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"strings"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 
 	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
 	"code.cloudfoundry.org/loggregator/plumbing"
+
+	"tools/reconnect"
+	"tools/selector"
 )
 
 var (
@@ -23,9 +33,17 @@ var (
 	caFile   = flag.String("ca", "", "ca cert to use to connect to rlp")
 
 	shardID       = flag.String("shard-id", "a-shard-id", "shard ID for stream sharding")
-	selectorTypes = flag.String("types", "", "comma separated list of envelope types to select on. default is all types.")
+	selectorTypes = flag.String("types", "", "comma separated selectors of the form [source-id/]type[:args], see the selector package. default is all types.")
+	sourceIDs     = flag.String("source-id", "", "comma separated source IDs of the selectors that do not have one")
+
+	duration   = flag.Duration("duration", 0, "how long to read for, 0 is until SIGINT")
+	count      = flag.Uint64("count", 0, "stop after reading this many envelopes, 0 is no limit")
+	maxBackoff = flag.Duration("max-backoff", 10*time.Second, "the longest to wait before reconnecting")
 )
 
+// minBackoff is how long to wait before the first reconnect.
+const minBackoff = 100 * time.Millisecond
+
 func main() {
 	flag.Parse()
 
@@ -51,68 +69,62 @@ func main() {
 		UsePreferredTags: true,
 	}
 
-	if *selectorTypes != "" {
-		req.Selectors = buildSelectors(*selectorTypes)
+	if *selectorTypes != "" || *sourceIDs != "" {
+		var ids []string
+		if *sourceIDs != "" {
+			for _, id := range strings.Split(*sourceIDs, ",") {
+				ids = append(ids, strings.TrimSpace(id))
+			}
+		}
+		req.Selectors, err = selector.Parse(*selectorTypes, ids)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	receiver, err := client.Receiver(context.TODO(), req)
-	if err != nil {
-		log.Fatal(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	if *duration > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), *duration)
 	}
+	defer cancel()
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
 
-	for {
-		env, err := receiver.Recv()
+	var envelopes uint64
+	read := func(ctx context.Context, connected func()) error {
+		receiver, err := client.Receiver(ctx, req)
 		if err != nil {
-			log.Fatalf("failed to receive from stream: %s", err)
+			return err
 		}
-		fmt.Printf("%+v\n", env)
-	}
-}
 
-func buildSelectors(types string) []*loggregator_v2.Selector {
-	chunks := strings.Split(types, ",")
-	var selectors []*loggregator_v2.Selector
-	for _, c := range chunks {
-		selectors = append(selectors, stringToSelector(c))
-	}
+		for {
+			env, err := receiver.Recv()
+			if err != nil {
+				return err
+			}
+			connected()
+			fmt.Printf("%+v\n", env)
 
-	return selectors
-}
-
-func stringToSelector(selectorType string) *loggregator_v2.Selector {
-	switch strings.TrimSpace(strings.ToLower(selectorType)) {
-	case "log":
-		return &loggregator_v2.Selector{
-			Message: &loggregator_v2.Selector_Log{
-				Log: &loggregator_v2.LogSelector{},
-			},
-		}
-	case "counter":
-		return &loggregator_v2.Selector{
-			Message: &loggregator_v2.Selector_Counter{
-				Counter: &loggregator_v2.CounterSelector{},
-			},
+			envelopes++
+			if *count > 0 && envelopes >= *count {
+				cancel()
+				return ctx.Err()
+			}
 		}
-	case "gauge":
-		return &loggregator_v2.Selector{
-			Message: &loggregator_v2.Selector_Gauge{
-				Gauge: &loggregator_v2.GaugeSelector{},
-			},
-		}
-	case "timer":
-		return &loggregator_v2.Selector{
-			Message: &loggregator_v2.Selector_Timer{
-				Timer: &loggregator_v2.TimerSelector{},
-			},
-		}
-	case "event":
-		return &loggregator_v2.Selector{
-			Message: &loggregator_v2.Selector_Event{
-				Event: &loggregator_v2.EventSelector{},
-			},
-		}
-	default:
-		log.Fatalf("Unknown selector type: %s", selectorType)
 	}
-	return nil
+
+	start := time.Now()
+	stats := reconnect.Run(ctx, reconnect.Backoff{Min: minBackoff, Max: *maxBackoff}, read)
+	log.Printf(
+		"read %d envelopes over %s, reconnects: %d, gaps: %d (%s)",
+		envelopes, time.Since(start), stats.Reconnects, stats.Gaps, stats.GapTime,
+	)
 }
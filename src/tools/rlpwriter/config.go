@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"tools/loadgen"
+)
+
+// maxSize is the largest payload size.
+const maxSize = 1 << 20
+
+// subscriptionConfig configures the envelopes sent to a subscription. The
+// fields use the syntax of the flags of the same name.
+type subscriptionConfig struct {
+	Types string `json:"types"`
+	Sizes string `json:"sizes"`
+	Rate  string `json:"rate"`
+	Burst int    `json:"burst"`
+	Count uint64 `json:"count"`
+}
+
+// stream is a parsed subscriptionConfig.
+type stream struct {
+	mix    loadgen.Mix
+	sizes  []int
+	phases []loadgen.Phase
+	burst  int
+	count  uint64
+}
+
+func (c subscriptionConfig) parse() (stream, error) {
+	m, err := loadgen.ParseMix(c.Types)
+	if err != nil {
+		return stream{}, err
+	}
+	sizes, err := loadgen.ParseSizes(c.Sizes, maxSize)
+	if err != nil {
+		return stream{}, err
+	}
+	phases, err := loadgen.ParsePattern(c.Rate)
+	if err != nil {
+		return stream{}, err
+	}
+
+	return stream{
+		mix:    m,
+		sizes:  sizes,
+		phases: phases,
+		burst:  c.Burst,
+		count:  c.Count,
+	}, nil
+}
+
+// configs holds the configs set for app IDs and shard IDs over HTTP.
+//
+//	GET    /config           lists the configs
+//	PUT    /config?id=<id>   sets the config for an app ID or shard ID
+//	DELETE /config?id=<id>   removes it
+//
+// A PUT only needs the fields that differ from the default config.
+type configs struct {
+	defaults subscriptionConfig
+
+	mu      sync.Mutex
+	configs map[string]subscriptionConfig
+}
+
+func newConfigs(defaults subscriptionConfig) *configs {
+	return &configs{
+		defaults: defaults,
+		configs:  make(map[string]subscriptionConfig),
+	}
+}
+
+// Get returns the config for the app ID, else for the shard ID, else the
+// default config.
+func (c *configs) Get(appID, shardID string) subscriptionConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cfg, ok := c.configs[appID]; ok && appID != "" {
+		return cfg
+	}
+	if cfg, ok := c.configs[shardID]; ok && shardID != "" {
+		return cfg
+	}
+	return c.defaults
+}
+
+func (c *configs) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		json.NewEncoder(rw).Encode(c.configs)
+	case http.MethodPut:
+		if id == "" {
+			http.Error(rw, "missing id", http.StatusBadRequest)
+			return
+		}
+
+		cfg := c.defaults
+		err := json.NewDecoder(r.Body).Decode(&cfg)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, err = cfg.parse()
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.configs[id] = cfg
+	case http.MethodDelete:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.configs, id)
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -1,5 +1,19 @@
 // rlpwriter: a tool that writes messages into RLP.
 //
+// It serves the doppler Subscribe endpoint. Each subscription gets envelopes
+// of the configured types and sizes, with real timestamps, paced to a
+// pattern of rates, and optionally stops after a count of envelopes. The
+// stream then stays open so the subscriber does not reconnect and get the
+// envelopes again.
+//
+// The flags configure every subscription. Configs for a subscription's app
+// ID or shard ID can be set over HTTP on /config, e.g.
+//
+//	curl -X PUT localhost:8080/config?id=app-guid \
+//	    -d '{"types": "counter,value", "rate": "10:5s,500:1s", "burst": 50}'
+//
+// and apply to the subscriptions made after.
+//
 package main
 
 import (
@@ -9,15 +23,15 @@ import (
 	"net"
 	"net/http"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
-	"github.com/cloudfoundry/sonde-go/events"
 	"github.com/gogo/protobuf/proto"
 	"google.golang.org/grpc"
 
 	"code.cloudfoundry.org/loggregator/plumbing"
+
+	"tools/loadgen"
 )
 
 var (
@@ -26,10 +40,14 @@ var (
 	certFile = flag.String("cert", "", "server cert")
 	keyFile  = flag.String("key", "", "server key")
 	caFile   = flag.String("ca", "", "ca cert used to validate client certs")
-	delay    = flag.Duration("delay", time.Second, "delay inbetween sending messages")
-)
+	delay    = flag.Duration("delay", time.Second, "delay inbetween sending messages (ignored if rate is set)")
 
-var msg1K []byte = []byte(strings.Repeat("J", 1024))
+	types = flag.String("types", "log", "comma separated envelope types with optional weights, e.g. log:8,counter:1,value:1 (log, counter, value, container, http)")
+	sizes = flag.String("sizes", "1024", "comma separated payload sizes in bytes that the envelopes cycle through")
+	rate  = flag.String("rate", "", "envelopes per second, or a repeating pattern of rates and durations, e.g. 100:10s,1000:2s")
+	burst = flag.Int("burst", 1, "how many envelopes can be sent at once after being idle")
+	count = flag.Uint64("count", 0, "how many envelopes to send to each subscription, 0 is no limit")
+)
 
 func main() {
 	flag.Parse()
@@ -47,25 +65,50 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
+	defaults := subscriptionConfig{
+		Types: *types,
+		Sizes: *sizes,
+		Rate:  *rate,
+		Burst: *burst,
+		Count: *count,
+	}
+	if defaults.Rate == "" {
+		if *delay <= 0 {
+			log.Fatal("rate is required when delay is 0")
+		}
+		defaults.Rate = strconv.FormatFloat(float64(time.Second)/float64(*delay), 'f', -1, 64)
+	}
+	_, err = defaults.parse()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	s := grpc.NewServer(grpc.Creds(creds))
-	srv := newServer()
+	srv := newServer(newConfigs(defaults))
 	plumbing.RegisterDopplerServer(s, srv)
 
 	go func() {
 		log.Fatal(s.Serve(lis))
 	}()
-	log.Fatal(http.ListenAndServe(*httpAddr, srv))
+
+	mux := http.NewServeMux()
+	mux.Handle("/", srv)
+	mux.Handle("/config", srv.configs)
+	log.Fatal(http.ListenAndServe(*httpAddr, mux))
 }
 
 type server struct {
 	plumbing.DopplerServer
+	configs *configs
+
 	mu     sync.Mutex
 	report map[string]int64
 }
 
-func newServer() *server {
+func newServer(c *configs) *server {
 	return &server{
-		report: make(map[string]int64),
+		configs: c,
+		report:  make(map[string]int64),
 	}
 }
 
@@ -82,22 +125,35 @@ func (s *server) set(appID string, v int64) {
 }
 
 func (s *server) Subscribe(req *plumbing.SubscriptionRequest, sub plumbing.Doppler_SubscribeServer) error {
-	var lastIdx int64
-	for {
-		e := &events.Envelope{
-			Origin:    proto.String("rlpwriter"),
-			EventType: events.Envelope_LogMessage.Enum(),
-			Tags: map[string]string{
-				"idx": strconv.FormatInt(lastIdx, 10),
-			},
-			LogMessage: &events.LogMessage{
-				Message:     msg1K,
-				MessageType: events.LogMessage_OUT.Enum(),
-				Timestamp:   proto.Int64(1234),
-				AppId:       &req.GetFilter().AppID,
-			},
+	appID := req.GetFilter().GetAppID()
+	st, err := s.configs.Get(appID, req.GetShardID()).parse()
+	if err != nil {
+		return err
+	}
+
+	// Envelopes without an app ID take their source ID from the source_id
+	// tag when converted to v2.
+	tags := map[string]string{}
+	if appID != "" {
+		tags["source_id"] = appID
+	}
+
+	ctx := sub.Context()
+	b := loadgen.NewBuilder(loadgen.BuilderConfig{
+		Origin: "rlpwriter",
+		AppID:  appID,
+		Tags:   tags,
+		SeqTag: "idx",
+		Sizes:  st.sizes,
+		Mix:    st.mix,
+	})
+	p := loadgen.NewPacer(st.phases, st.burst)
+	for st.count == 0 || b.Count() < st.count {
+		if !p.Wait(ctx.Done()) {
+			return nil
 		}
-		data, err := proto.Marshal(e)
+
+		data, err := proto.Marshal(b.Next())
 		if err != nil {
 			log.Fatalf("error while marshalling: %s", err)
 		}
@@ -105,9 +161,9 @@ func (s *server) Subscribe(req *plumbing.SubscriptionRequest, sub plumbing.Doppl
 		if err != nil {
 			return nil
 		}
-		s.set(req.GetFilter().AppID, lastIdx)
-		lastIdx++
-		time.Sleep(*delay)
+		s.set(appID, int64(b.Count()-1))
 	}
+
+	<-ctx.Done()
 	return nil
 }
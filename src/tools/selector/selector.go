@@ -0,0 +1,140 @@
+// Package selector parses the selector syntax shared by the RLP readers.
+//
+// A selector list is a comma separated list of selectors of the form
+//
+//	[source-id/]type[:args]
+//
+// where type is one of log, counter, gauge, timer, event or all. A counter
+// takes an optional name, e.g. counter:requests. A gauge takes optional names
+// joined with +, and selects only the gauges that contain all of them, e.g.
+// gauge:cpu+memory. The type all selects every type and takes no args.
+//
+// A selector without a source ID selects each of the default source IDs, or
+// every source ID if there are none.
+package selector
+
+import (
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+)
+
+// Types are the envelope types that can be selected, in the order all
+// expands to.
+var Types = []string{"log", "counter", "gauge", "timer", "event"}
+
+// Parse parses a selector list. An empty list selects all types.
+func Parse(s string, sourceIDs []string) ([]*loggregator_v2.Selector, error) {
+	if strings.TrimSpace(s) == "" {
+		s = "all"
+	}
+	if len(sourceIDs) == 0 {
+		sourceIDs = []string{""}
+	}
+
+	var selectors []*loggregator_v2.Selector
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return nil, fmt.Errorf("empty selector in %q", s)
+		}
+
+		ids := sourceIDs
+		if !hasType(term) {
+			i := strings.Index(term, "/")
+			if i < 0 {
+				return nil, fmt.Errorf("unknown selector type: %q", term)
+			}
+			ids = []string{term[:i]}
+			term = term[i+1:]
+		}
+
+		typ, args := term, ""
+		if i := strings.Index(term, ":"); i >= 0 {
+			typ, args = term[:i], term[i+1:]
+		}
+
+		for _, id := range ids {
+			s, err := build(id, strings.ToLower(typ), args)
+			if err != nil {
+				return nil, err
+			}
+			selectors = append(selectors, s...)
+		}
+	}
+	return selectors, nil
+}
+
+// hasType reports whether the selector starts with a type rather than a
+// source ID.
+func hasType(term string) bool {
+	typ := term
+	if i := strings.Index(term, ":"); i >= 0 {
+		typ = term[:i]
+	}
+	typ = strings.ToLower(typ)
+
+	if typ == "all" {
+		return true
+	}
+	for _, t := range Types {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+func build(sourceID, typ, args string) ([]*loggregator_v2.Selector, error) {
+	if typ == "all" {
+		if args != "" {
+			return nil, fmt.Errorf("all selector does not take args: %q", args)
+		}
+		var selectors []*loggregator_v2.Selector
+		for _, t := range Types {
+			s, _ := build(sourceID, t, "")
+			selectors = append(selectors, s...)
+		}
+		return selectors, nil
+	}
+
+	if args != "" && typ != "counter" && typ != "gauge" {
+		return nil, fmt.Errorf("%s selector does not take args: %q", typ, args)
+	}
+
+	s := &loggregator_v2.Selector{SourceId: sourceID}
+	switch typ {
+	case "log":
+		s.Message = &loggregator_v2.Selector_Log{
+			Log: &loggregator_v2.LogSelector{},
+		}
+	case "counter":
+		s.Message = &loggregator_v2.Selector_Counter{
+			Counter: &loggregator_v2.CounterSelector{
+				Name: args,
+			},
+		}
+	case "gauge":
+		var names []string
+		if args != "" {
+			names = strings.Split(args, "+")
+		}
+		s.Message = &loggregator_v2.Selector_Gauge{
+			Gauge: &loggregator_v2.GaugeSelector{
+				Names: names,
+			},
+		}
+	case "timer":
+		s.Message = &loggregator_v2.Selector_Timer{
+			Timer: &loggregator_v2.TimerSelector{},
+		}
+	case "event":
+		s.Message = &loggregator_v2.Selector_Event{
+			Event: &loggregator_v2.EventSelector{},
+		}
+	default:
+		return nil, fmt.Errorf("unknown selector type: %q", typ)
+	}
+	return []*loggregator_v2.Selector{s}, nil
+}
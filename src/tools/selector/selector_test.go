@@ -0,0 +1,125 @@
+package selector_test
+
+import (
+	"tools/selector"
+
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parse", func() {
+	It("selects every type when empty", func() {
+		selectors, err := selector.Parse("", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selectors).To(Equal([]*loggregator_v2.Selector{
+			logSelector(""),
+			counterSelector("", ""),
+			gaugeSelector(""),
+			timerSelector(""),
+			eventSelector(""),
+		}))
+	})
+
+	It("parses a list of types", func() {
+		selectors, err := selector.Parse("log, Timer,event", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selectors).To(Equal([]*loggregator_v2.Selector{
+			logSelector(""),
+			timerSelector(""),
+			eventSelector(""),
+		}))
+	})
+
+	It("parses counter and gauge names", func() {
+		selectors, err := selector.Parse("counter:http/requests,gauge:cpu+memory", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selectors).To(Equal([]*loggregator_v2.Selector{
+			counterSelector("", "http/requests"),
+			gaugeSelector("", "cpu", "memory"),
+		}))
+	})
+
+	It("selects each default source ID", func() {
+		selectors, err := selector.Parse("log,counter:requests", []string{"app-a", "app-b"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selectors).To(Equal([]*loggregator_v2.Selector{
+			logSelector("app-a"),
+			logSelector("app-b"),
+			counterSelector("app-a", "requests"),
+			counterSelector("app-b", "requests"),
+		}))
+	})
+
+	It("uses the source ID of a selector over the defaults", func() {
+		selectors, err := selector.Parse("doppler/gauge,app-c/all", []string{"app-a"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selectors).To(Equal([]*loggregator_v2.Selector{
+			gaugeSelector("doppler"),
+			logSelector("app-c"),
+			counterSelector("app-c", ""),
+			gaugeSelector("app-c"),
+			timerSelector("app-c"),
+			eventSelector("app-c"),
+		}))
+	})
+
+	DescribeTable("invalid selectors",
+		func(s string) {
+			_, err := selector.Parse(s, nil)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("unknown type", "metric"),
+		Entry("unknown type with source ID", "app-a/metric"),
+		Entry("empty selector", "log,,counter"),
+		Entry("args on log", "log:foo"),
+		Entry("args on all", "all:foo"),
+	)
+})
+
+func logSelector(sourceID string) *loggregator_v2.Selector {
+	return &loggregator_v2.Selector{
+		SourceId: sourceID,
+		Message: &loggregator_v2.Selector_Log{
+			Log: &loggregator_v2.LogSelector{},
+		},
+	}
+}
+
+func counterSelector(sourceID, name string) *loggregator_v2.Selector {
+	return &loggregator_v2.Selector{
+		SourceId: sourceID,
+		Message: &loggregator_v2.Selector_Counter{
+			Counter: &loggregator_v2.CounterSelector{Name: name},
+		},
+	}
+}
+
+func gaugeSelector(sourceID string, names ...string) *loggregator_v2.Selector {
+	return &loggregator_v2.Selector{
+		SourceId: sourceID,
+		Message: &loggregator_v2.Selector_Gauge{
+			Gauge: &loggregator_v2.GaugeSelector{Names: names},
+		},
+	}
+}
+
+func timerSelector(sourceID string) *loggregator_v2.Selector {
+	return &loggregator_v2.Selector{
+		SourceId: sourceID,
+		Message: &loggregator_v2.Selector_Timer{
+			Timer: &loggregator_v2.TimerSelector{},
+		},
+	}
+}
+
+func eventSelector(sourceID string) *loggregator_v2.Selector {
+	return &loggregator_v2.Selector{
+		SourceId: sourceID,
+		Message: &loggregator_v2.Selector_Event{
+			Event: &loggregator_v2.EventSelector{},
+		},
+	}
+}
@@ -1,70 +1,182 @@
 // udpwriter: a tool that writes messages into a metron via UDP. It is meant
 // to stress metron's capability to read and process messages.
 //
-// There are two writers that spawn when running, a fast writer and a slow
-// writer. This allows a variance in the rates of message writes. The slow
-// writer will author log messages with the origin of "slow" and the fast
-// writer will author log messages with the origin of "fast".
+// A number of writers, each with its own connection, write envelopes of the
+// configured types and sizes. The writers share a pacer that paces them to
+// the target rate. When the duration is up, or on SIGINT, a summary
+// of the envelopes written and the write errors is printed.
+//
+// Each envelope is tagged with the ID of its writer and its sequence number,
+// which metronreader uses to count lost, duplicated and reordered envelopes.
 //
 package main
 
 import (
+	"crypto/rand"
 	"flag"
-	"io"
+	"fmt"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/cloudfoundry/sonde-go/events"
 	"github.com/gogo/protobuf/proto"
+
+	"tools/loadgen"
+)
+
+// maxSize is the largest payload that fits in a UDP datagram along with the
+// rest of the envelope.
+const maxSize = 60000
+
+const (
+	// writerIDTag and seqTag tag each envelope with the ID of the writer
+	// and its sequence number, so metronreader can account for lost,
+	// duplicated and reordered envelopes.
+	writerIDTag = "writer_id"
+	seqTag      = "seq"
 )
 
 var (
-	target = flag.String("target", "localhost:3457", "the host:port of the target metron")
-	fast   = flag.Duration("fast", time.Second, "the delay of the fast writer")
-	slow   = flag.Duration("slow", time.Second, "the delay of the slow writer")
+	target   = flag.String("target", "localhost:3457", "the host:port of the target metron")
+	types    = flag.String("types", "log", "comma separated envelope types to write (log, counter, value, container, http), each with an optional weight, e.g. log:8,counter:1")
+	sizes    = flag.String("sizes", "0", "comma separated payload sizes in bytes that the envelopes cycle through")
+	rate     = flag.Float64("rate", 1, "the target rate of all writers in envelopes per second, 0 is unlimited")
+	burst    = flag.Int("burst", 1, "the number of envelopes that can be written at once above the rate")
+	writers  = flag.Int("writers", 1, "the number of parallel writers")
+	duration = flag.Duration("duration", 0, "how long to write for, 0 is forever")
+	origin   = flag.String("origin", "udpwriter", "the origin of the envelopes")
+	appID    = flag.String("app-id", "udpwriter", "the app ID of log and container metric envelopes")
 )
 
+// counters are the totals of all writers.
+type counters struct {
+	sent   uint64
+	bytes  uint64
+	errors uint64
+}
+
 func main() {
 	flag.Parse()
 
-	conn, err := net.Dial("udp", *target)
+	m, err := loadgen.ParseMix(*types)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s, err := loadgen.ParseSizes(*sizes, maxSize)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *writers < 1 {
+		log.Fatal("writers must be at least 1")
+	}
+	if *rate < 0 {
+		log.Fatal("rate must not be negative")
+	}
 
-	go writeSlow(conn)
-	writeFast(conn)
-}
+	var pacer *loadgen.Pacer
+	if *rate > 0 {
+		pacer = loadgen.NewPacer([]loadgen.Phase{{Rate: *rate}}, *burst)
+	}
 
-func writeSlow(conn io.Writer) {
-	write(*slow, "slow", conn)
+	runID := randString()
+	log.Printf("writer IDs: %s-0 to %s-%d", runID, runID, *writers-1)
+
+	var c counters
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < *writers; i++ {
+		conn, err := net.Dial("udp", *target)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func(i int, conn net.Conn) {
+			defer wg.Done()
+			defer conn.Close()
+			b := loadgen.NewBuilder(loadgen.BuilderConfig{
+				Origin: *origin,
+				AppID:  *appID,
+				Index:  i,
+				Tags:   map[string]string{writerIDTag: fmt.Sprintf("%s-%d", runID, i)},
+				SeqTag: seqTag,
+				Sizes:  s,
+				Mix:    m,
+			})
+			write(conn, b, pacer, &c, stop)
+		}(i, conn)
+	}
+
+	start := time.Now()
+	wait(*duration)
+	close(stop)
+	wg.Wait()
+
+	printSummary(&c, time.Since(start))
 }
 
-func writeFast(conn io.Writer) {
-	write(*fast, "fast", conn)
+// wait returns after d, or on SIGINT. If d is 0 it only returns on SIGINT.
+func wait(d time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+
+	var timeout <-chan time.Time
+	if d > 0 {
+		timeout = time.After(d)
+	}
+
+	select {
+	case <-signals:
+	case <-timeout:
+	}
 }
 
-func write(delay time.Duration, msg string, conn io.Writer) {
+func write(conn net.Conn, b *loadgen.Builder, pacer *loadgen.Pacer, c *counters, stop chan struct{}) {
 	for {
-		env := &events.Envelope{
-			Origin:    &msg,
-			Timestamp: proto.Int64(time.Now().UnixNano()),
-			EventType: events.Envelope_LogMessage.Enum(),
-			LogMessage: &events.LogMessage{
-				Message:     []byte{},
-				MessageType: events.LogMessage_OUT.Enum(),
-				Timestamp:   proto.Int64(time.Now().UnixNano()),
-			},
+		select {
+		case <-stop:
+			return
+		default:
 		}
-		envData, err := proto.Marshal(env)
+
+		if pacer != nil && !pacer.Wait(stop) {
+			return
+		}
+
+		envData, err := proto.Marshal(b.Next())
 		if err != nil {
 			log.Fatal(err)
 		}
 		_, err = conn.Write(envData)
 		if err != nil {
+			atomic.AddUint64(&c.errors, 1)
 			log.Print(err)
+			continue
 		}
-		time.Sleep(delay)
+		atomic.AddUint64(&c.sent, 1)
+		atomic.AddUint64(&c.bytes, uint64(len(envData)))
+	}
+}
+
+func printSummary(c *counters, elapsed time.Duration) {
+	sent := atomic.LoadUint64(&c.sent)
+	fmt.Printf("elapsed: %s\n", elapsed)
+	fmt.Printf("sent: %d\n", sent)
+	fmt.Printf("bytes: %d\n", atomic.LoadUint64(&c.bytes))
+	fmt.Printf("errors: %d\n", atomic.LoadUint64(&c.errors))
+	fmt.Printf("rate: %.1f/s\n", float64(sent)/elapsed.Seconds())
+}
+
+func randString() string {
+	b := make([]byte, 3)
+	_, err := rand.Read(b)
+	if err != nil {
+		log.Panicf("unable to read randomness %s:", err)
 	}
+	return fmt.Sprintf("%x", b)
 }